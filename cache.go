@@ -0,0 +1,50 @@
+package ghru
+
+import "sync"
+
+// ReleaseCache is an optional cache for the Github releases API responses.
+// Cached responses are revalidated using their ETag, which (when unchanged)
+// does not count towards the Github API rate limit.
+var ReleaseCache Cache
+
+// Cache is the interface for storing Github API responses, keyed by url.
+// Implementations may persist entries to retain them between restarts.
+type Cache interface {
+	Get(key string) (CacheEntry, bool)
+	Set(key string, entry CacheEntry)
+}
+
+// CacheEntry is a cached Github API response
+type CacheEntry struct {
+	ETag string // response ETag
+	Link string // pagination Link header
+	Body []byte // response body
+}
+
+// MemoryCache is an in-memory Cache, safe for concurrent use
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]CacheEntry
+}
+
+// Get implements Cache
+func (c *MemoryCache) Get(key string) (CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+
+	return entry, ok
+}
+
+// Set implements Cache
+func (c *MemoryCache) Set(key string, entry CacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]CacheEntry)
+	}
+
+	c.entries[key] = entry
+}
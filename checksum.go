@@ -0,0 +1,153 @@
+package ghru
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// VerifyChecksum defines whether the downloaded release asset must be verified
+// against the checksums asset of the release before it is installed
+var VerifyChecksum = false
+
+// ChecksumAlgorithm is the hash algorithm of the checksums asset: "sha256",
+// "sha512" or "blake2b" (BLAKE2b-512). If empty, the algorithm is detected
+// from the checksums asset name (eg: SHA512SUMS), defaulting to "sha256".
+var ChecksumAlgorithm = ""
+
+// ChecksumAsset is the name of the release asset containing the checksums.
+// It is a template which may contain {{.Name}}, {{.Version}}, {{.Tag}}, {{.Asset}}
+// and {{.Arm}} (the ARM version, if any), eg:
+// "{{.Name}}_{{.Version}}_checksums.txt"
+var ChecksumAsset = "checksums.txt"
+
+// fetchChecksum downloads the release checksums asset and returns the
+// checksum of the release asset
+func fetchChecksum(ctx context.Context, rel Release) (string, error) {
+	if rel.ChecksumURL == "" {
+		return "", fmt.Errorf("No checksums asset found for %s", rel.Tag)
+	}
+
+	ctx, cancel := withTimeout(ctx, RequestTimeout)
+	defer cancel()
+
+	resp, err := httpGet(ctx, rel.ChecksumURL, "application/octet-stream")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	return findChecksum(resp.Body, rel.Name)
+}
+
+// verifyChecksum compares the checksum of the downloaded file against
+// the expected checksum of the algorithm
+func verifyChecksum(file, algorithm, expected string) error {
+	actual, err := fileChecksum(file, algorithm)
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(expected, actual) {
+		return fmt.Errorf("Checksum mismatch for %s: expected %s, got %s", filepath.Base(file), expected, actual)
+	}
+
+	return nil
+}
+
+// verifyDigest compares the checksum of the downloaded file against the
+// asset digest provided by Github, eg: "sha256:<checksum>"
+func verifyDigest(rel Release, file string) error {
+	parts := strings.SplitN(rel.Digest, ":", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("Invalid digest for %s: %s", rel.Name, rel.Digest)
+	}
+
+	return verifyChecksum(file, parts[0], parts[1])
+}
+
+// findChecksum returns the checksum for the filename from a checksums file
+// in the format of sha256sum (and sha512sum, b2sum), ie: "<checksum>  <filename>"
+func findChecksum(r io.Reader, filename string) (string, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		// binary mode checksums prefix the filename with "*"
+		if strings.TrimPrefix(fields[1], "*") == filename {
+			return fields[0], nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", fmt.Errorf("No checksum found for %s", filename)
+}
+
+// checksumAlgorithm returns the ChecksumAlgorithm, or if not set, detects
+// the algorithm from the name of the checksums asset
+func checksumAlgorithm(name string) string {
+	if ChecksumAlgorithm != "" {
+		return ChecksumAlgorithm
+	}
+
+	name = strings.ToLower(name)
+
+	switch {
+	case strings.Contains(name, "sha512"):
+		return "sha512"
+	case strings.Contains(name, "blake2") || strings.Contains(name, "b2sum"):
+		return "blake2b"
+	default:
+		return "sha256"
+	}
+}
+
+// newHash returns a new hash of the checksum algorithm
+func newHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	case "blake2b":
+		return blake2b.New512(nil)
+	default:
+		return nil, fmt.Errorf("Unsupported checksum algorithm %q, expected sha256, sha512 or blake2b", algorithm)
+	}
+}
+
+// fileChecksum returns the hex encoded checksum of a file
+func fileChecksum(file, algorithm string) (string, error) {
+	h, err := newHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
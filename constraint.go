@@ -0,0 +1,159 @@
+package ghru
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/axllent/semver"
+)
+
+// Constraint is an optional version constraint which releases must satisfy to
+// be considered for updates, eg: ">=1.2.0 <2.0.0". Comparisons are separated
+// by spaces (or commas) and must all match, and alternatives are separated by
+// "||". The operators are =, !=, >, >=, <, <=, ^ (same major version, eg:
+// "^1.2.0" is ">=1.2.0 <2.0.0") and ~ (same minor version, eg: "~1.2.0" is
+// ">=1.2.0 <1.3.0"). Explicitly requested versions (UpdateTo) are not affected.
+var Constraint = ""
+
+// constraint is a parsed Constraint, a list of alternatives
+// of which all comparisons must match
+type constraint [][]comparison
+
+// comparison is a single version comparison, eg: ">=1.2.0"
+type comparison struct {
+	op      string
+	version string
+}
+
+// parseConstraint parses a version constraint
+func parseConstraint(s string) (constraint, error) {
+	c := constraint{}
+
+	for _, alt := range strings.Split(s, "||") {
+		fields := strings.Fields(strings.Replace(alt, ",", " ", -1))
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("Invalid Constraint %q: empty comparison", s)
+		}
+
+		comparisons := []comparison{}
+		for i := 0; i < len(fields); i++ {
+			op, version := splitOperator(fields[i])
+			if version == "" && i+1 < len(fields) {
+				// space between the operator and version, eg: ">= 1.2.0"
+				i++
+				version = fields[i]
+			}
+
+			if !isValidVersion(version) {
+				return nil, fmt.Errorf("Invalid Constraint %q: invalid version %q", s, version)
+			}
+
+			switch op {
+			case "^", "~":
+				upper, err := upperBound(op, version)
+				if err != nil {
+					return nil, fmt.Errorf("Invalid Constraint %q: %s", s, err)
+				}
+				comparisons = append(comparisons, comparison{">=", version}, comparison{"<", upper})
+			default:
+				comparisons = append(comparisons, comparison{op, version})
+			}
+		}
+
+		c = append(c, comparisons)
+	}
+
+	return c, nil
+}
+
+// splitOperator splits a comparison into the operator and version
+func splitOperator(s string) (string, string) {
+	for _, op := range []string{">=", "<=", "!=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(s, op) {
+			return op, strings.TrimPrefix(s, op)
+		}
+	}
+
+	return "=", s
+}
+
+// upperBound returns the exclusive upper bound of a ^ or ~ comparison
+func upperBound(op, version string) (string, error) {
+	major, minor, err := majorMinor(version)
+	if err != nil {
+		return "", err
+	}
+
+	if op == "~" || major == 0 && VersionScheme == "semver" {
+		// ~1.2.3 (and ^0.2.3) allows patch updates
+		return fmt.Sprintf("%d.%d.0", major, minor+1), nil
+	}
+
+	return fmt.Sprintf("%d.0.0", major+1), nil
+}
+
+// majorMinor returns the major & minor version numbers of a version
+func majorMinor(version string) (int, int, error) {
+	if VersionScheme == "calver" {
+		segments, _, _ := parseCalver(version)
+		if len(segments) < 2 {
+			return segments[0], 0, nil
+		}
+		return segments[0], segments[1], nil
+	}
+
+	major, err := strconv.Atoi(semver.Major(NormalizeVersion(version)))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	minor, err := strconv.Atoi(semver.Minor(NormalizeVersion(version)))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return major, minor, nil
+}
+
+// allows returns whether the version satisfies the constraint
+func (c constraint) allows(version string) bool {
+	for _, alt := range c {
+		matched := true
+		for _, cmp := range alt {
+			if !cmp.matches(version) {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matches returns whether the version satisfies the comparison
+func (cmp comparison) matches(version string) bool {
+	r := CompareVersions(version, cmp.version)
+
+	switch cmp.op {
+	case "=":
+		return r == 0
+	case "!=":
+		return r != 0
+	case ">":
+		return r > 0
+	case ">=":
+		return r >= 0
+	case "<":
+		// pre-releases of a stable version are also excluded, eg: "<2.0.0" excludes 2.0.0-beta
+		return r < 0 && (IsPrerelease(cmp.version) || CompareVersions(versionBase(version), cmp.version) < 0)
+	case "<=":
+		return r <= 0
+	default:
+		return false
+	}
+}
@@ -0,0 +1,81 @@
+package ghru
+
+import "testing"
+
+func TestConstraint(t *testing.T) {
+	tests := []struct {
+		scheme     string
+		constraint string
+		version    string
+		allowed    bool
+	}{
+		{"semver", "=1.2.0", "1.2.0", true},
+		{"semver", "1.2.0", "v1.2.0", true},
+		{"semver", "=1.2.0", "1.2.1", false},
+		{"semver", "!=1.2.0", "1.2.0", false},
+		{"semver", "!=1.2.0", "1.2.1", true},
+		{"semver", ">1.2.0", "1.2.0", false},
+		{"semver", ">1.2.0", "1.2.1", true},
+		{"semver", ">=1.2.0", "1.2.0", true},
+		{"semver", ">= 1.2.0", "1.1.9", false},
+		{"semver", "<1.2.0", "1.1.9", true},
+		{"semver", "<1.2.0", "1.2.0", false},
+		{"semver", "<=1.2.0", "1.2.0", true},
+		{"semver", "<=1.2.0", "1.2.1", false},
+		{"semver", ">=1.2.0 <2.0.0", "1.9.9", true},
+		{"semver", ">=1.2.0, <2.0.0", "2.0.0", false},
+		{"semver", "^1.2", "1.2.0", true},
+		{"semver", "^1.2.3", "1.9.0", true},
+		{"semver", "^1.2.3", "1.2.2", false},
+		{"semver", "^1.2.3", "2.0.0", false},
+		{"semver", "^0.2.3", "0.2.9", true},
+		{"semver", "^0.2.3", "0.3.0", false},
+		{"semver", "~1.2.3", "1.2.9", true},
+		{"semver", "~1.2.3", "1.3.0", false},
+		{"semver", "~1.2.3 || >=2.1.0", "2.0.0", false},
+		{"semver", "~1.2.3 || >=2.1.0", "2.1.0", true},
+		// pre-releases of the upper bound are excluded
+		{"semver", "<2.0.0", "2.0.0-beta.1", false},
+		{"semver", "^1.2.0", "2.0.0-beta.1", false},
+		{"semver", "<2.0.0", "1.9.0-beta.1", true},
+		{"semver", "<2.0.0-rc.2", "2.0.0-rc.1", true},
+		{"calver", ">=2024.1.0", "2024.05.1", true},
+		{"calver", "^2024.1", "2024.12.31", true},
+		{"calver", "^2024.1", "2025.01.01", false},
+		{"calver", "~2024.05", "2024.05.30", true},
+		{"calver", "~2024.05", "2024.06.01", false},
+	}
+
+	defer func() { VersionScheme = "semver" }()
+
+	for _, tt := range tests {
+		VersionScheme = tt.scheme
+
+		c, err := parseConstraint(tt.constraint)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.constraint, err)
+			continue
+		}
+
+		if allowed := c.allows(tt.version); allowed != tt.allowed {
+			t.Errorf("%s: expected %s allowed to be %v", tt.constraint, tt.version, tt.allowed)
+		}
+	}
+}
+
+func TestConstraintErrors(t *testing.T) {
+	for _, constraint := range []string{
+		"",
+		">=1.0.0 ||",
+		"|| <2.0.0",
+		">=",
+		">= <2.0.0",
+		"1.x",
+		"^1.x",
+		">=1.0.0, latest",
+	} {
+		if _, err := parseConstraint(constraint); err == nil {
+			t.Errorf("%q: expected an error", constraint)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package ghru
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrNoReleases is returned when the repository has no (eligible) releases
+	ErrNoReleases = errors.New("No releases found")
+
+	// ErrNoMatchingAsset is returned when releases exist, but none contain
+	// a binary asset for this OS & architecture
+	ErrNoMatchingAsset = errors.New("No binary releases found")
+
+	// ErrUpToDate is returned when no newer release is available
+	ErrUpToDate = errors.New("No newer releases found")
+
+	// ErrHostNotAllowed is returned when an asset download (or redirect) is
+	// to a host which is not in the AllowedDownloadHosts
+	ErrHostNotAllowed = errors.New("Download host is not allowed")
+)
+
+// RateLimitError is returned when the Github API rate limit has been exceeded
+type RateLimitError struct {
+	// Reset is the time at which the rate limit window resets
+	Reset time.Time
+}
+
+// Error implements error
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("Github API rate limit exceeded, resets at %s", e.Reset.Format(time.RFC3339))
+}
+
+// statusError is returned for unsuccessful HTTP responses
+type statusError struct {
+	StatusCode int
+	Body       string
+}
+
+// Error implements error
+func (e *statusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("Received status code %d", e.StatusCode)
+	}
+
+	return fmt.Sprintf("Received status code %d: %s", e.StatusCode, e.Body)
+}
@@ -2,208 +2,2187 @@ package ghru
 
 import (
 	"compress/bzip2"
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// AllowPrereleases defines whether pre-releases may be included
+var AllowPrereleases = false
+
+// AssetPattern is an optional regular expression used to select the release
+// asset instead of the default naming convention. It is matched against the
+// full asset name, with the first matching asset being used. Archives (eg:
+// .tar.gz or .zip) are not supported and never match.
+var AssetPattern = ""
+
+// AssetName is an optional exact name of the release asset, for projects which
+// publish a single asset for all platforms. It takes precedence over AssetPattern
+// and the default naming convention. It must be a bz2 or gz compressed (or
+// uncompressed) binary, archives (eg: .tar.gz or .zip) are not supported.
+var AssetName = ""
+
+// VersionFromAsset is an optional regular expression to derive the version of
+// a release from its asset names rather than the tag, for projects where the
+// tags are not versions, eg: `myapp_(v?\d+\.\d+\.\d+)_`. The version is
+// the first capture group (or the whole match), and is also available in the
+// asset templates as {{.Version}}, with the tag as {{.Tag}}.
+var VersionFromAsset = ""
+
+// AssetSelector is an optional function to select the release asset from the
+// assets matching the naming convention (or AssetPattern), which are given in
+// order of preference. It is called for each release with matching assets.
+// If nil, the first asset is used.
+var AssetSelector func(candidates []Asset) (Asset, error)
+
+// OS optionally overrides runtime.GOOS when resolving the release asset,
+// eg: for testing the asset selection of other platforms
+var OS = ""
+
+// Arch optionally overrides runtime.GOARCH when resolving the release asset
+var Arch = ""
+
+// Libc optionally overrides the detected C library of Linux systems, either
+// "gnu" or "musl" (eg: Alpine). Linux assets named with the C library, eg:
+// myapp_1.2.3_linux_amd64_musl, are preferred over assets without.
+var Libc = ""
+
+// Arm optionally overrides the detected ARM version ("5", "6" or "7") of 32-bit
+// ARM systems. Assets named with the ARM version, eg: myapp_1.2.3_linux_armv7,
+// are preferred, followed by older ARM versions and assets named arm.
+var Arm = ""
+
+// Channel optionally defines the update channel using the semver pre-release
+// identifier, eg: "beta" allows stable releases & "-beta*" pre-releases, and
+// "stable" only allows stable releases. If set, AllowPrereleases is ignored.
+var Channel = ""
+
+// ArchFallbacks are optional architectures to use if no release asset matches
+// the primary architecture, in order of preference, eg: []string{"amd64"} for
+// arm64 systems able to run amd64 binaries via emulation (Rosetta 2)
+var ArchFallbacks = []string{}
+
+// UniversalArch is the architecture name of macOS universal binaries, which
+// is used if no release asset matches the architecture on darwin
+var UniversalArch = "universal"
+
+// Aliases are alternative OS & architecture names which are tried if no
+// release asset matches the Go naming (runtime.GOOS & runtime.GOARCH)
+var Aliases = map[string][]string{
+	"amd64":  {"x86_64"},
+	"386":    {"i386"},
+	"arm64":  {"aarch64"},
+	"darwin": {"macos"},
+}
+
+// CaseInsensitiveMatch defines whether release assets are matched case-insensitively
+var CaseInsensitiveMatch = false
+
+// Token is an optional Github access token used to authenticate API requests
+// and asset downloads, required for private repositories
+var Token = ""
+
+// DryRun defines whether Update should only download & extract the release
+// binary to the temporary directory, without replacing the running binary.
+// The binary does not need to be writable.
+var DryRun = false
+
+// KeepBackup defines whether the previous binary is kept after an update,
+// allowing it to be restored with Rollback()
+var KeepBackup = false
+
+// AllowDowngrade defines whether UpdateTo may install an older version
+var AllowDowngrade = false
+
+// ForceReinstall defines whether Update reinstalls the latest release if it is
+// the current version, eg: to replace a corrupted binary or a republished asset.
+// Uncompressed assets with a Github digest are not reinstalled if unchanged.
+var ForceReinstall = false
+
+// VerifyCommand is an optional list of arguments (eg: "--version") the new
+// binary is run with before it is installed, which must exit successfully.
+// Note that this executes the downloaded binary.
+var VerifyCommand = []string{}
+
+// ExpectVersionOutput defines whether the output of the VerifyCommand must
+// contain the release version
+var ExpectVersionOutput = false
+
+// verifyCommandTimeout is the maximum time the VerifyCommand may run for
+const verifyCommandTimeout = 30 * time.Second
+
+// MajorVersionLock defines whether updates are limited to releases with the
+// same major version as the current version, eg: 1.x.x will not be updated to
+// 2.x.x, which may contain breaking changes
+var MajorVersionLock = false
+
+// MustPassThrough is an optional list of versions which cannot be skipped, eg:
+// versions which migrate data. If a newer release is available, the oldest of
+// these versions newer than the current version is installed first.
+var MustPassThrough = []string{}
+
+// MinReleaseAge is the minimum time since a release was published before it is
+// considered for updates, eg: 24 * time.Hour to give time for a broken release
+// to be withdrawn. Explicitly requested versions (UpdateTo), ListReleases and
+// ReleaseNotesSince are not affected.
+var MinReleaseAge time.Duration
+
+// now returns the current time, and can be replaced to test time-based policies
+var now = time.Now
+
+// MaxExtractSize is the maximum size in bytes of a decompressed release
+// binary, guarding against decompression bombs. 0 disables the limit.
+var MaxExtractSize int64 = 1 << 30
+
+// PreUpdate is an optional hook called before a release is downloaded &
+// installed. Returning an error cancels the update.
+var PreUpdate func(rel Release) error
+
+// OnUpdate is an optional hook called after the binary has been successfully
+// replaced. An error is returned to the caller, but the update is not reverted.
+var OnUpdate func(previousVersion string, rel Release) error
+
+// InstallPath is an optional path to install the release binary to instead of
+// replacing the running binary, eg: to install or update a different tool.
+// It is also used by Rollback and Uninstall. If the file does not exist, the
+// binary is installed (use an empty current version).
+var InstallPath = ""
+
+// TempDir is the directory in which releases are downloaded & extracted.
+// If empty, os.TempDir() is used, unless it is on a different device to the
+// binary, in which case the binary's directory is used. A unique subdirectory
+// is created per update.
+var TempDir = ""
+
+// KeepTempFiles defines whether the temporary update directory is kept
+// after an update, for debugging purposes
+var KeepTempFiles = false
+
+// ProgressFunc is an optional function called periodically while downloading
+// the release asset with the download progress
+var ProgressFunc func(p ProgressInfo)
+
+// Logger is an optional function called with diagnostic messages, eg: why
+// releases were skipped. It is compatible with log.Printf.
+var Logger func(format string, v ...interface{})
+
+// ProgressInfo is the progress of a download
+type ProgressInfo struct {
+	// Downloaded is the number of bytes downloaded
+	Downloaded int64
+	// Total is the total size in bytes (0 if unknown)
+	Total int64
+	// BytesPerSecond is the (moving average) download speed
+	BytesPerSecond float64
+	// ETA is the estimated time remaining (0 if unknown)
+	ETA time.Duration
+}
+
+// HTTPClient is an optional HTTP client used for all requests. If nil, a client
+// using the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables is used.
+// A custom client is responsible for its own proxy configuration.
+var HTTPClient *http.Client
+
+// UserAgent is the User-Agent header sent with all requests, which Github
+// recommends identifying the application, eg: "myapp/1.2.3"
+var UserAgent = "ghru"
+
+// defaultClient is the HTTP client used if no HTTPClient is set
+var defaultClient = newDefaultClient()
+
+// RequestTimeout is the timeout for Github API requests, 0 for no timeout.
+// It is not used with a custom HTTPClient.
+var RequestTimeout time.Duration
+
+// DownloadTimeout is the timeout for downloading a release asset, 0 for no
+// timeout. It is not used with a custom HTTPClient.
+var DownloadTimeout time.Duration
+
+// MirrorURLs is an optional list of mirrors from which the release asset is
+// downloaded if the download from Github fails. Assets are downloaded from
+// <mirror>/<tag>/<asset>, and are verified the same as Github downloads.
+var MirrorURLs = []string{}
+
+// AllowedDownloadHosts is an optional list of hosts which release assets may be
+// downloaded from, including any redirects, eg: "github.com" and
+// "objects.githubusercontent.com". The Github API host is always allowed.
+var AllowedDownloadHosts = []string{}
+
+// BaseURL is the base URL of the Github API. For Github Enterprise Server
+// this is typically https://<host>/api/v3. For testing, it can also be a local
+// directory (or file:// URL) containing a releases.json and the release assets.
+var BaseURL = "https://api.github.com"
+
+// LatestEndpoint defines whether only the latest release is fetched (with the
+// Github /releases/latest endpoint) when checking for stable updates, falling
+// back to all releases if it has no suitable asset. Github's latest release is
+// the most recently published rather than the highest version, so only enable
+// this if older versions are never released after newer versions, eg: patch
+// releases of a previous major version.
+var LatestEndpoint = false
+
+// maxReleasePages is the maximum number of release pages (of 100) fetched
+const maxReleasePages = 10
+
+// repoRegex matches a valid Github repository, eg: axllent/ghru
+var repoRegex = regexp.MustCompile(`^[\w.-]+/[\w.-]+$`)
+
+// cpuArchRegex matches the CPU architecture version in /proc/cpuinfo
+var cpuArchRegex = regexp.MustCompile(`(?m)^CPU architecture\s*:\s*(\d+)`)
+
+// contentTypes are the Github asset content types of each file type
+var contentTypes = map[string][]string{
+	"bz2": {"application/x-bzip2", "application/x-bzip"},
+	"gz":  {"application/gzip", "application/x-gzip"},
+	"binary": {
+		"application/x-executable", "application/x-elf", "application/x-mach-binary",
+		"application/x-msdownload", "application/x-dosexec", "application/vnd.microsoft.portable-executable",
+	},
+}
+
+// Releases struct for Github releases json
+type Releases []struct {
+	Name       string    `json:"name"`         // release name
+	Tag        string    `json:"tag_name"`     // release tag
+	Prerelease bool      `json:"prerelease"`   // Github pre-release
+	Draft      bool      `json:"draft"`        // Github draft release
+	Body       string    `json:"body"`         // release notes
+	Published  time.Time `json:"published_at"` // publish date
+	Assets     []Asset   `json:"assets"`       // release assets
+}
+
+// Asset struct for Github release asset json
+type Asset struct {
+	BrowserDownloadURL string `json:"browser_download_url"`
+	ID                 int64  `json:"id"`
+	Name               string `json:"name"`
+	Size               int64  `json:"size"`
+	Digest             string `json:"digest"`
+	ContentType        string `json:"content_type"`
+}
+
+// Release struct contains the file data for downloadable release
+type Release struct {
+	Name string
+	Tag  string
+	URL  string
+	Size int64
+	ID   int64
+	// ChecksumURL is the download url of the checksums asset, if any
+	ChecksumURL string
+	// ChecksumAlgorithm is the hash algorithm of the checksums asset
+	ChecksumAlgorithm string
+	// SignatureURL is the download url of the signature asset, if any
+	SignatureURL string
+	// ReleaseNotes are the release notes (description) of the release
+	ReleaseNotes string
+	// PublishedAt is the date the release was published
+	PublishedAt time.Time
+	// FileType is the asset file type: "bz2", "gz" or "binary" (uncompressed)
+	FileType string
+	// Version is the version of the release, which is the tag unless
+	// derived from the asset names with VersionFromAsset
+	Version string
+	// Prerelease is whether the release is a pre-release, either by its
+	// version or the Github pre-release option
+	Prerelease bool
+	// Digest is the digest of the asset provided by Github (if any),
+	// eg: "sha256:<checksum>"
+	Digest string
+}
+
+// Latest fetches the latest release info & returns release tag, filename & download url
+func Latest(repo, name string) (string, string, string, error) {
+	return LatestContext(context.Background(), repo, name)
+}
+
+// LatestContext is like Latest, but the request can be cancelled via the context
+func LatestContext(ctx context.Context, repo, name string) (string, string, string, error) {
+	rel, err := latest(ctx, repo, name)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	return rel.Tag, rel.Name, rel.URL, nil
+}
+
+// ListReleases returns all releases containing a suitable binary asset,
+// sorted by version with the newest release first
+func ListReleases(repo, name string) ([]Release, error) {
+	return ListReleasesContext(context.Background(), repo, name)
+}
+
+// ListReleasesContext is like ListReleases, but the request can be cancelled via the context
+func ListReleasesContext(ctx context.Context, repo, name string) ([]Release, error) {
+	allReleases, err := fetchReleases(ctx, repo, name, true, fetchReleaseList)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(allReleases, func(i, j int) bool {
+		return IsNewer(allReleases[i].Version, allReleases[j].Version)
+	})
+
+	return allReleases, nil
+}
+
+// ReleaseNotesSince returns all releases newer than the current version, with
+// the newest release first, allowing the release notes of each to be displayed
+func ReleaseNotesSince(repo, name, currentVersion string) ([]Release, error) {
+	return ReleaseNotesSinceContext(context.Background(), repo, name, currentVersion)
+}
+
+// ReleaseNotesSinceContext is like ReleaseNotesSince, but the request can be cancelled via the context
+func ReleaseNotesSinceContext(ctx context.Context, repo, name, currentVersion string) ([]Release, error) {
+	allReleases, err := ListReleasesContext(ctx, repo, name)
+	if err != nil {
+		return nil, err
+	}
+
+	newer := []Release{}
+	for _, r := range allReleases {
+		if IsNewer(r.Version, currentVersion) {
+			newer = append(newer, r)
+		}
+	}
+
+	return newer, nil
+}
+
+// AssetURL returns the download url of the release asset of a version (or the
+// latest release if empty) for this OS & architecture, eg: for an external
+// downloader. With a Token this is a Github API url, which must be requested
+// with the "Authorization: Bearer <token>" & "Accept: application/octet-stream" headers.
+// With a local BaseURL this is the absolute file:// url of the asset.
+func AssetURL(repo, name, version string) (string, error) {
+	return AssetURLContext(context.Background(), repo, name, version)
+}
+
+// AssetURLContext is like AssetURL, but the request can be cancelled via the context
+func AssetURLContext(ctx context.Context, repo, name, version string) (string, error) {
+	var rel Release
+	var err error
+
+	if version == "" {
+		rel, err = latest(ctx, repo, name)
+	} else {
+		rel, err = releaseVersion(ctx, repo, name, version)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if _, ok := localDir(); ok {
+		return localFileURL(rel.Name)
+	}
+
+	return rel.URL, nil
+}
+
+// latest returns the latest release containing a suitable binary asset
+func latest(ctx context.Context, repo, name string) (Release, error) {
+	if useLatestEndpoint() {
+		allReleases, err := fetchReleases(ctx, repo, name, true, fetchLatestRelease)
+		if err == nil {
+			return newestRelease(allReleases), nil
+		}
+		if !latestFallback(err) {
+			return Release{}, err
+		}
+	}
+
+	allReleases, err := fetchReleases(ctx, repo, name, true, fetchReleaseList)
+	if err != nil {
+		return Release{}, err
+	}
+
+	return newestRelease(minReleaseAge(allReleases)), nil
+}
+
+// minReleaseAge returns the releases published at least MinReleaseAge ago
+func minReleaseAge(allReleases []Release) []Release {
+	if MinReleaseAge <= 0 {
+		return allReleases
+	}
+
+	result := []Release{}
+	for _, r := range allReleases {
+		if now().Sub(r.PublishedAt) < MinReleaseAge {
+			// published too recently, skip
+			logf("Skipping release %s: published less than %s ago", r.Tag, MinReleaseAge)
+			continue
+		}
+		result = append(result, r)
+	}
+
+	return result
+}
+
+// newestRelease returns the release with the highest version
+func newestRelease(allReleases []Release) Release {
+	var latestRelease = Release{}
+
+	for _, r := range allReleases {
+		// detect the latest release
+		if IsNewer(r.Version, latestRelease.Version) {
+			latestRelease = r
+		}
+	}
+
+	return latestRelease
+}
+
+// useLatestEndpoint returns whether the latest release can be fetched alone,
+// ie: only the newest stable release is eligible
+func useLatestEndpoint() bool {
+	if _, ok := localDir(); ok {
+		return false
+	}
+
+	stable := Channel == "stable" || (Channel == "" && !AllowPrereleases)
+
+	return LatestEndpoint && stable && Constraint == "" && VersionFromAsset == "" && MinReleaseAge <= 0
+}
+
+// latestFallback returns whether all releases must be fetched after fetching
+// the latest release failed, ie: it has no suitable asset or does not exist
+func latestFallback(err error) bool {
+	return isNotFound(err) || errors.Is(err, ErrNoReleases) || errors.Is(err, ErrNoMatchingAsset)
+}
+
+// isNotFound returns whether the error is a 404 response
+func isNotFound(err error) bool {
+	var se *statusError
+	return errors.As(err, &se) && se.StatusCode == http.StatusNotFound
+}
+
+// fetchReleases returns all releases containing a suitable binary asset.
+// If filter is set, releases are filtered using AllowPrereleases, Channel,
+// & Constraint. The releases are fetched with list, ie:
+// fetchReleaseList or fetchLatestRelease.
+func fetchReleases(ctx context.Context, repo, name string, filter bool, list func(context.Context, string) (Releases, error)) ([]Release, error) {
+	// validate the configuration before making any requests
+	if !repoRegex.MatchString(repo) {
+		return nil, fmt.Errorf("Invalid repository %q, expected <owner>/<repo>", repo)
+	}
+
+	if VersionScheme != "semver" && VersionScheme != "calver" {
+		return nil, fmt.Errorf("Invalid VersionScheme %q, expected semver or calver", VersionScheme)
+	}
+
+	checksumTpl, err := template.New("checksum").Parse(ChecksumAsset)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid ChecksumAsset: %s", err)
+	}
+
+	if ChecksumAlgorithm != "" {
+		if _, err := newHash(ChecksumAlgorithm); err != nil {
+			return nil, err
+		}
+	}
+
+	signatureTpl, err := template.New("signature").Parse(SignatureAsset)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid SignatureAsset: %s", err)
+	}
+
+	var pattern *regexp.Regexp
+	if AssetPattern != "" {
+		flags := ""
+		if CaseInsensitiveMatch {
+			flags = "(?i)"
+		}
+		pattern, err = regexp.Compile(flags + "^(?:" + AssetPattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("Invalid AssetPattern: %s", err)
+		}
+	}
+
+	if AssetName != "" && detectFileType(AssetName) == "unsupported" {
+		return nil, fmt.Errorf("Invalid AssetName %q: archives are not supported, expected a bz2 or gz compressed or uncompressed binary", AssetName)
+	}
+
+	var versionConstraint constraint
+	if filter && Constraint != "" {
+		if versionConstraint, err = parseConstraint(Constraint); err != nil {
+			return nil, err
+		}
+	}
+
+	var versionRegex *regexp.Regexp
+	if VersionFromAsset != "" {
+		versionRegex, err = regexp.Compile(VersionFromAsset)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid VersionFromAsset: %s", err)
+		}
+	}
+
+	releases, err := list(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(releases) == 0 {
+		// the repository has no releases yet
+		return nil, ErrNoReleases
+	}
+
+	linkOS, linkArch := platform()
+	linkExt := ""
+	if linkOS == "windows" {
+		linkExt = ".exe"
+	}
+	linkLibc := libc(linkOS)
+	linkArm := armVersion(linkOS, linkArch)
+
+	var allReleases = []Release{}
+
+	// the expected binary name of the newest eligible release, for error reporting
+	expected := ""
+	// whether any eligible release has assets, for error reporting
+	hasAssets := false
+	// an unsupported archive matching the AssetPattern, for error reporting
+	unsupported := ""
+
+	// loop through releases
+	for _, r := range releases {
+		if r.Draft {
+			// drafts are not published, skip
+			logf("Skipping release %s: draft", r.Tag)
+			continue
+		}
+
+		version := r.Tag
+		if versionRegex != nil {
+			version = assetVersion(r.Assets, versionRegex)
+		}
+
+		if !isValidVersion(version) {
+			// Invalid version, skip
+			logf("Skipping release %s: invalid version %q", r.Tag, version)
+			continue
+		}
+
+		if filter && !channelAllows(version, r.Prerelease) {
+			// pre-release not allowed, skip
+			logf("Skipping release %s: pre-release", r.Tag)
+			continue
+		}
+
+		if versionConstraint != nil && !versionConstraint.allows(version) {
+			// version not allowed by the Constraint, skip
+			logf("Skipping release %s: does not match the constraint %s", r.Tag, Constraint)
+			continue
+		}
+
+		// binary names in order of preference of the architecture
+		binaryNames := []string{}
+		for _, osName := range withAliases([]string{linkOS}) {
+			for _, arch := range archCandidates(linkOS, linkArch, linkArm) {
+				binaryName := fmt.Sprintf("%s_%s_%s_%s", name, version, osName, arch)
+				if linkLibc != "" {
+					// prefer assets built for the C library
+					binaryNames = append(binaryNames, binaryName+"_"+linkLibc+linkExt)
+				}
+				binaryNames = append(binaryNames, binaryName+linkExt)
+			}
+		}
+		if expected == "" {
+			expected = fmt.Sprintf("%s_%s_%s_%s%s", name, version, linkOS, linkArch, linkExt)
+		}
+
+		if len(r.Assets) == 0 {
+			// eg: created without uploading any binaries
+			logf("Skipping release %s: no assets", r.Tag)
+			continue
+		}
+		hasAssets = true
+
+		candidates := matchAssets(r.Assets, binaryNames, pattern)
+		if len(candidates) == 0 {
+			if pattern != nil && unsupported == "" {
+				for _, a := range r.Assets {
+					if pattern.MatchString(a.Name) {
+						unsupported = a.Name
+						break
+					}
+				}
+			}
+			logf("Skipping release %s: no matching asset for %s/%s", r.Tag, linkOS, linkArch)
+			continue
+		}
+
+		a := candidates[0]
+		if AssetSelector != nil {
+			if a, err = AssetSelector(candidates); err != nil {
+				return nil, err
+			}
+		}
+
+		fileType := detectFileType(a.Name)
+		if fileType == "unsupported" {
+			return nil, fmt.Errorf("Unsupported release asset %s: archives are not supported, expected a bz2 or gz compressed or uncompressed binary", a.Name)
+		}
+
+		// data for the checksum & signature asset templates
+		tplData := map[string]string{"Name": name, "Version": version, "Tag": r.Tag, "Asset": a.Name, "Arm": linkArm}
+
+		var checksumName, signatureName strings.Builder
+		if err := checksumTpl.Execute(&checksumName, tplData); err != nil {
+			return nil, err
+		}
+		if err := signatureTpl.Execute(&signatureName, tplData); err != nil {
+			return nil, err
+		}
+
+		thisRelease := Release{
+			Name:         a.Name,
+			Tag:          r.Tag,
+			Version:      version,
+			Prerelease:   r.Prerelease || IsPrerelease(version),
+			URL:          assetURL(repo, a),
+			Size:         a.Size,
+			ID:           a.ID,
+			ReleaseNotes: r.Body,
+			PublishedAt:  r.Published,
+			FileType:     fileType,
+			Digest:       a.Digest,
+		}
+		if c, ok := findAsset(r.Assets, checksumName.String()); ok {
+			thisRelease.ChecksumURL = assetURL(repo, c)
+			thisRelease.ChecksumAlgorithm = checksumAlgorithm(c.Name)
+		}
+		if c, ok := findAsset(r.Assets, signatureName.String()); ok {
+			thisRelease.SignatureURL = assetURL(repo, c)
+		}
+		allReleases = append(allReleases, thisRelease)
+	}
+
+	if expected == "" {
+		return nil, ErrNoReleases
+	}
+
+	if len(allReleases) == 0 {
+		// no releases with suitable assets found
+		if !hasAssets {
+			return nil, fmt.Errorf("%w (the releases have no assets)", ErrNoMatchingAsset)
+		}
+		if AssetName != "" {
+			return nil, fmt.Errorf("%w (expected an asset named %s)", ErrNoMatchingAsset, AssetName)
+		}
+		if unsupported != "" {
+			return nil, fmt.Errorf("%w (%s matches %s, but archives are not supported)", ErrNoMatchingAsset, unsupported, AssetPattern)
+		}
+		if pattern != nil {
+			return nil, fmt.Errorf("%w (no asset matches %s)", ErrNoMatchingAsset, AssetPattern)
+		}
+		return nil, fmt.Errorf("%w (expected an asset named %s.bz2, %s.gz or %s)", ErrNoMatchingAsset, expected, expected, expected)
+	}
+
+	return allReleases, nil
+}
+
+// assetVersion returns the version from the first asset name matching the
+// regular expression, or an empty string if no assets match
+func assetVersion(assets []Asset, re *regexp.Regexp) string {
+	for _, a := range assets {
+		m := re.FindStringSubmatch(a.Name)
+		if m == nil {
+			continue
+		}
+
+		// use the first capture group if there is one
+		if len(m) > 1 {
+			return m[1]
+		}
+
+		return m[0]
+	}
+
+	return ""
+}
+
+// channelAllows returns whether a release version is allowed by the
+// AllowPrereleases & Channel settings
+func channelAllows(tag string, prerelease bool) bool {
+	pre := versionPrerelease(tag)
+	if pre == "" && !prerelease {
+		// stable releases are always allowed
+		return true
+	}
+
+	switch Channel {
+	case "":
+		return AllowPrereleases
+	case "stable":
+		return false
+	default:
+		// the first pre-release identifier, eg: "beta" from "-beta.1"
+		label := strings.SplitN(strings.TrimPrefix(pre, "-"), ".", 2)[0]
+		return pre != "" && strings.HasPrefix(label, Channel)
+	}
+}
+
+// platform returns the OS & architecture to resolve release assets for
+func platform() (string, string) {
+	linkOS := runtime.GOOS
+	if OS != "" {
+		linkOS = OS
+	}
+
+	linkArch := runtime.GOARCH
+	if Arch != "" {
+		linkArch = Arch
+	}
+
+	return linkOS, linkArch
+}
+
+// libc returns the C library of the platform ("gnu" or "musl") for Linux,
+// detected by the presence of the musl dynamic linker
+func libc(linkOS string) string {
+	if linkOS != "linux" {
+		return ""
+	}
+
+	if Libc != "" {
+		return Libc
+	}
+
+	if linkOS != runtime.GOOS {
+		// cannot be detected for another OS
+		return ""
+	}
+
+	if matches, _ := filepath.Glob("/lib/ld-musl-*"); len(matches) > 0 {
+		return "musl"
+	}
+
+	return "gnu"
+}
+
+// armVersion returns the ARM version of 32-bit ARM platforms, detected from the
+// CPU architecture on Linux
+func armVersion(linkOS, linkArch string) string {
+	if linkArch != "arm" {
+		return ""
+	}
+
+	if Arm != "" {
+		return Arm
+	}
+
+	if linkOS != "linux" || runtime.GOOS != "linux" || runtime.GOARCH != "arm" {
+		// cannot be detected for another platform
+		return ""
+	}
+
+	cpuinfo, err := ioutil.ReadFile("/proc/cpuinfo")
+	if err != nil {
+		return ""
+	}
+
+	m := cpuArchRegex.FindSubmatch(cpuinfo)
+	if m == nil {
+		return ""
+	}
+
+	v, _ := strconv.Atoi(string(m[1]))
+	if v > 7 {
+		// 64-bit CPUs running a 32-bit OS support armv7
+		v = 7
+	}
+
+	return strconv.Itoa(v)
+}
+
+// archCandidates returns the architectures to match release assets for,
+// in order of preference
+func archCandidates(linkOS, linkArch, linkArm string) []string {
+	archs := []string{linkArch}
+
+	if v, err := strconv.Atoi(linkArm); err == nil {
+		// ARM versions can run binaries built for older versions
+		archs = []string{}
+		for ; v >= 5; v-- {
+			archs = append(archs, fmt.Sprintf("armv%d", v))
+		}
+		archs = append(archs, linkArch)
+	}
+
+	fallbacks := ArchFallbacks
+	if linkOS == "darwin" && UniversalArch != "" {
+		// universal binaries run natively, so are preferred over emulation
+		fallbacks = append([]string{UniversalArch}, fallbacks...)
+	}
+
+	for _, arch := range fallbacks {
+		if arch != linkArch {
+			archs = append(archs, arch)
+		}
+	}
+
+	return withAliases(archs)
+}
+
+// withAliases returns the names each followed by their Aliases
+func withAliases(names []string) []string {
+	result := []string{}
+	for _, n := range names {
+		result = append(result, n)
+		result = append(result, Aliases[n]...)
+	}
+
+	return result
+}
+
+// matchAssets returns the binary assets in order of preference. If AssetName
+// is set only that asset is returned. If a pattern is given, the assets matching
+// the pattern are returned, else the binary names are tried in order, preferring
+// compressed assets over uncompressed binaries. Unsupported archives never match,
+// and assets with a content type not matching their file type (eg: text/plain)
+// are least preferred.
+func matchAssets(assets []Asset, binaryNames []string, pattern *regexp.Regexp) []Asset {
+	matches := []Asset{}
+
+	if AssetName != "" {
+		if a, ok := findAsset(assets, AssetName); ok && detectFileType(a.Name) != "unsupported" {
+			matches = append(matches, a)
+		}
+
+		return matches
+	}
+
+	if pattern != nil {
+		for _, a := range assets {
+			if pattern.MatchString(a.Name) && detectFileType(a.Name) != "unsupported" {
+				matches = append(matches, a)
+			}
+		}
+	} else {
+		for _, binaryName := range binaryNames {
+			for _, fileType := range []string{"bz2", "gz", "binary"} {
+				if a, ok := findAsset(assets, assetName(binaryName, fileType)); ok {
+					matches = append(matches, a)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return contentTypeMatches(matches[i]) && !contentTypeMatches(matches[j])
+	})
+
+	return matches
+}
+
+// contentTypeMatches returns whether the content type of an asset matches its
+// file type. Missing & generic (application/octet-stream) content types match.
+func contentTypeMatches(a Asset) bool {
+	mediaType, _, _ := mime.ParseMediaType(a.ContentType)
+	if mediaType == "" || mediaType == "application/octet-stream" {
+		return true
+	}
+
+	for _, t := range contentTypes[detectFileType(a.Name)] {
+		if mediaType == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// detectFileType returns the file type of an asset based on its extension,
+// "unsupported" for archives which cannot be installed as a binary
+func detectFileType(filename string) string {
+	lower := strings.ToLower(filename)
+	for _, ext := range []string{".tar", ".tar.gz", ".tgz", ".tar.bz2", ".tbz2", ".tar.xz", ".zip", ".7z"} {
+		if strings.HasSuffix(lower, ext) {
+			return "unsupported"
+		}
+	}
+
+	switch filepath.Ext(lower) {
+	case ".bz2":
+		return "bz2"
+	case ".gz":
+		return "gz"
+	default:
+		return "binary"
+	}
+}
+
+// fetchReleaseList fetches the releases of a repository from the Github API,
+// following the pagination up to maxReleasePages
+func fetchReleaseList(ctx context.Context, repo string) (Releases, error) {
+	releaseURL := fmt.Sprintf("%s/repos/%s/releases?per_page=100", apiURL(), repo)
+	if _, ok := localDir(); ok {
+		releaseURL = localURL("releases.json")
+	}
+
+	var releases Releases
+
+	for page := 0; page < maxReleasePages && releaseURL != ""; page++ {
+		entry, err := fetchAPI(ctx, releaseURL)
+		if err != nil {
+			return nil, err
+		}
+
+		var pageReleases Releases
+
+		if err := json.Unmarshal(entry.Body, &pageReleases); err != nil {
+			return nil, fmt.Errorf("Failed to parse releases: %s", err)
+		}
+
+		releases = append(releases, pageReleases...)
+		releaseURL = nextPageURL(entry.Link)
+	}
+
+	return releases, nil
+}
+
+// fetchLatestRelease fetches the latest release of a repository from the Github
+// API, which is the most recent release which is not a pre-release (or draft)
+func fetchLatestRelease(ctx context.Context, repo string) (Releases, error) {
+	return fetchRelease(ctx, fmt.Sprintf("%s/repos/%s/releases/latest", apiURL(), repo))
+}
+
+// fetchTagRelease returns a function which fetches the release of a tag from
+// the Github API
+func fetchTagRelease(tag string) func(context.Context, string) (Releases, error) {
+	return func(ctx context.Context, repo string) (Releases, error) {
+		return fetchRelease(ctx, fmt.Sprintf("%s/repos/%s/releases/tags/%s", apiURL(), repo, url.PathEscape(tag)))
+	}
+}
+
+// fetchRelease fetches a single release from the Github API
+func fetchRelease(ctx context.Context, releaseURL string) (Releases, error) {
+	entry, err := fetchAPI(ctx, releaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	releases := make(Releases, 1)
+	if err := json.Unmarshal(entry.Body, &releases[0]); err != nil {
+		return nil, fmt.Errorf("Failed to parse release: %s", err)
+	}
+
+	return releases, nil
+}
+
+// fetchAPI performs a Github API request, using the ReleaseCache if set
+func fetchAPI(ctx context.Context, apiURL string) (CacheEntry, error) {
+	var entry CacheEntry
+
+	err := withRetry(ctx, func() error {
+		reqCtx, cancel := withTimeout(ctx, RequestTimeout)
+		defer cancel()
+
+		req, err := newRequest(reqCtx, apiURL, "application/vnd.github.v3+json")
+		if err != nil {
+			return err
+		}
+
+		cached, isCached := CacheEntry{}, false
+		if ReleaseCache != nil {
+			if cached, isCached = ReleaseCache.Get(apiURL); isCached && cached.ETag != "" {
+				req.Header.Set("If-None-Match", cached.ETag)
+			}
+		}
+
+		resp, err := doRequest(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode == http.StatusNotModified && isCached {
+			// unchanged since the last request
+			entry = cached
+			return nil
+		}
+
+		if err := checkJSON(resp); err != nil {
+			return err
+		}
+
+		entry.ETag = resp.Header.Get("ETag")
+		entry.Link = resp.Header.Get("Link")
+		entry.Body, err = ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+
+		if ReleaseCache != nil && entry.ETag != "" {
+			ReleaseCache.Set(apiURL, entry)
+		}
+
+		return nil
+	})
+
+	return entry, err
+}
+
+// nextPageURL returns the url of the next page from a Link header, if any
+func nextPageURL(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		sections := strings.Split(part, ";")
+		if len(sections) < 2 {
+			continue
+		}
+
+		for _, param := range sections[1:] {
+			if strings.TrimSpace(param) == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(sections[0]), "<>")
+			}
+		}
+	}
+
+	return ""
+}
+
+// assetName returns the asset filename of the binary for the file type
+func assetName(binaryName, fileType string) string {
+	if fileType == "binary" {
+		return binaryName
+	}
+
+	return binaryName + "." + fileType
+}
+
+// findAsset returns the asset matching the filename (case-insensitive if
+// CaseInsensitiveMatch is set)
+func findAsset(assets []Asset, filename string) (Asset, bool) {
+	for _, a := range assets {
+		if a.Name == filename || CaseInsensitiveMatch && strings.EqualFold(a.Name, filename) {
+			return a, true
+		}
+	}
+
+	return Asset{}, false
+}
+
+// assetURL returns the download url of a release asset. Private assets
+// are only downloadable via the API, so the API url is used with a Token.
+func assetURL(repo string, a Asset) string {
+	if _, ok := localDir(); ok {
+		return localURL(a.Name)
+	}
+
+	if Token != "" {
+		return fmt.Sprintf("%s/repos/%s/releases/assets/%d", apiURL(), repo, a.ID)
+	}
+
+	return a.BrowserDownloadURL
+}
+
+// UpdateResult describes the outcome of an update, and can be marshalled
+// to JSON for reporting
+type UpdateResult struct {
+	// Updated is set if the binary was replaced
+	Updated bool `json:"updated"`
+	// FromVersion is the version that was (or would be) replaced
+	FromVersion string `json:"from_version"`
+	// FromPrerelease is set if FromVersion is a pre-release, eg: to offer
+	// users of a pre-release build to switch back to stable releases
+	FromPrerelease bool `json:"from_prerelease"`
+	// ToVersion is the version of the release being installed, if any
+	ToVersion string `json:"to_version,omitempty"`
+	// Asset is the name of the release asset, if any
+	Asset string `json:"asset,omitempty"`
+	// Bytes is the size of the downloaded release asset
+	Bytes int64 `json:"bytes"`
+	// Duration is the time taken (in nanoseconds when marshalled)
+	Duration time.Duration `json:"duration"`
+	// Error is the error message if the update failed
+	Error string `json:"error,omitempty"`
+	// Release is the installed release
+	Release Release `json:"-"`
+	// InstalledPath is the resolved path of the binary that was replaced
+	InstalledPath string `json:"installed_path,omitempty"`
+	// BackupPath is the location of the previous binary if it was kept
+	BackupPath string `json:"backup_path,omitempty"`
+	// MoreUpdates is set if a MustPassThrough version was installed
+	// and a newer release is available
+	MoreUpdates bool `json:"more_updates"`
+}
+
+// Update the running binary with the latest release binary from Github
+func Update(repo, appName, currentVersion string) (string, error) {
+	return UpdateContext(context.Background(), repo, appName, currentVersion)
+}
+
+// UpdateContext is like Update, but the update can be cancelled via the context
+func UpdateContext(ctx context.Context, repo, appName, currentVersion string) (string, error) {
+	res, err := SelfUpdateContext(ctx, repo, appName, currentVersion)
+	if err != nil {
+		return "", err
+	}
+
+	return res.Release.Tag, nil
+}
+
+// SelfUpdate is like Update, but returns details of the installed release
+// and where it was installed
+func SelfUpdate(repo, appName, currentVersion string) (UpdateResult, error) {
+	return SelfUpdateContext(context.Background(), repo, appName, currentVersion)
+}
+
+// SelfUpdateContext is like SelfUpdate, but the update can be cancelled via the context
+func SelfUpdateContext(ctx context.Context, repo, appName, currentVersion string) (res UpdateResult, err error) {
+	start := time.Now()
+	defer func() {
+		res.FromVersion = currentVersion
+		res.FromPrerelease = IsPrerelease(currentVersion)
+		res.Duration = time.Since(start)
+		if err != nil {
+			res.Error = err.Error()
+		}
+	}()
+
+	rel, newest, err := hasUpdate(ctx, repo, appName, currentVersion)
+	if err != nil {
+		return res, err
+	}
+
+	if !IsNewer(rel.Version, currentVersion) && !reinstall(rel, currentVersion) {
+		if rel.Version == "" {
+			// no releases of the locked major version
+			return res, ErrUpToDate
+		}
+		logf("Skipping release %s: not newer than %s", rel.Tag, currentVersion)
+		return res, fmt.Errorf("%w (latest %s)", ErrUpToDate, rel.Version)
+	}
+
+	res, err = install(ctx, rel, currentVersion)
+	res.MoreUpdates = CompareVersions(rel.Version, newest.Version) != 0
+
+	return res, err
+}
+
+// reinstall returns whether the release of the current version must be installed
+// again with ForceReinstall, ie: the asset differs from the running binary
+func reinstall(rel Release, currentVersion string) bool {
+	if !ForceReinstall || rel.Version == "" || CompareVersions(rel.Version, currentVersion) != 0 {
+		return false
+	}
+
+	if rel.FileType != "binary" || rel.Digest == "" {
+		// the asset cannot be compared
+		return true
+	}
+
+	exe, err := installPath()
+	if err != nil {
+		return true
+	}
+
+	parts := strings.SplitN(rel.Digest, ":", 2)
+	if len(parts) != 2 {
+		return true
+	}
+
+	checksum, err := fileChecksum(exe, parts[0])
+
+	return err != nil || !strings.EqualFold(checksum, parts[1])
+}
+
+// HasUpdate returns the latest release, and whether it is newer than the current version
+func HasUpdate(repo, appName, currentVersion string) (Release, bool, error) {
+	return HasUpdateContext(context.Background(), repo, appName, currentVersion)
+}
+
+// HasUpdateContext is like HasUpdate, but the request can be cancelled via the context
+func HasUpdateContext(ctx context.Context, repo, appName, currentVersion string) (Release, bool, error) {
+	rel, _, err := hasUpdate(ctx, repo, appName, currentVersion)
+	if err != nil {
+		return Release{}, false, err
+	}
+
+	return rel, IsNewer(rel.Version, currentVersion), nil
+}
+
+// sameMajorVersion returns the releases with the same major version as the version
+func sameMajorVersion(allReleases []Release, version string) []Release {
+	major := versionMajor(version)
+
+	result := []Release{}
+	for _, r := range allReleases {
+		if versionMajor(r.Version) == major {
+			result = append(result, r)
+		} else {
+			logf("Skipping release %s: different major version to %s", r.Tag, version)
+		}
+	}
+
+	return result
+}
+
+// hasUpdate returns the release to update to, and the latest release. These
+// differ if a MustPassThrough version must be installed before the latest.
+func hasUpdate(ctx context.Context, repo, appName, currentVersion string) (Release, Release, error) {
+	if !MajorVersionLock && len(MustPassThrough) == 0 {
+		// only the latest release is needed
+		rel, err := latest(ctx, repo, appName)
+		return rel, rel, err
+	}
+
+	allReleases, err := fetchReleases(ctx, repo, appName, true, fetchReleaseList)
+	if err != nil {
+		return Release{}, Release{}, err
+	}
+
+	allReleases = minReleaseAge(allReleases)
+
+	if MajorVersionLock {
+		allReleases = sameMajorVersion(allReleases, currentVersion)
+	}
+
+	newest := newestRelease(allReleases)
+
+	// the oldest required version between the current & latest versions
+	required := ""
+	for _, v := range MustPassThrough {
+		if IsNewer(v, currentVersion) && IsNewer(newest.Version, v) && (required == "" || IsNewer(required, v)) {
+			required = v
+		}
+	}
+
+	if required == "" {
+		return newest, newest, nil
+	}
+
+	for _, r := range allReleases {
+		if CompareVersions(r.Version, required) == 0 {
+			return r, newest, nil
+		}
+	}
+
+	return Release{}, Release{}, fmt.Errorf("No binary release found for required version %s", required)
+}
+
+// UpdateTo updates (or downgrades) the running binary to a specific release version
+func UpdateTo(repo, appName, currentVersion, version string) (string, error) {
+	return UpdateToContext(context.Background(), repo, appName, currentVersion, version)
+}
+
+// UpdateToContext is like UpdateTo, but the update can be cancelled via the context
+func UpdateToContext(ctx context.Context, repo, appName, currentVersion, version string) (string, error) {
+	rel, err := releaseVersion(ctx, repo, appName, version)
+	if err != nil {
+		return "", err
+	}
+
+	switch CompareVersions(rel.Version, currentVersion) {
+	case 0:
+		return "", fmt.Errorf("%w (%s is already installed)", ErrUpToDate, currentVersion)
+	case -1:
+		if !AllowDowngrade {
+			return "", fmt.Errorf("Version %s is older than %s, downgrades are not allowed", rel.Version, currentVersion)
+		}
+	}
+
+	if _, err := install(ctx, rel, currentVersion); err != nil {
+		return "", err
+	}
+
+	return rel.Tag, nil
+}
+
+// releaseVersion returns the release of a specific version (or tag). The release
+// is fetched by its tag if possible, otherwise it is found in all releases.
+func releaseVersion(ctx context.Context, repo, appName, version string) (Release, error) {
+	// the version is explicitly requested, so pre-releases are allowed
+	if _, ok := localDir(); !ok && VersionFromAsset == "" {
+		// the tag may or may not have a "v" prefix
+		tags := []string{version, "v" + version}
+		if strings.HasPrefix(version, "v") {
+			tags[1] = strings.TrimPrefix(version, "v")
+		}
+
+		for _, tag := range tags {
+			allReleases, err := fetchReleases(ctx, repo, appName, false, fetchTagRelease(tag))
+			if err == nil {
+				return allReleases[0], nil
+			}
+			if !isNotFound(err) && !errors.Is(err, ErrNoReleases) {
+				return Release{}, err
+			}
+		}
+	}
+
+	allReleases, err := fetchReleases(ctx, repo, appName, false, fetchReleaseList)
+	if err != nil {
+		return Release{}, err
+	}
+
+	for _, r := range allReleases {
+		if r.Tag == version || CompareVersions(r.Version, version) == 0 {
+			return r, nil
+		}
+	}
+
+	return Release{}, fmt.Errorf("No binary release found for %s", version)
+}
+
+// installMu serializes changes to the running binary, ie: concurrent updates
+var installMu sync.Mutex
+
+// install downloads the release binary and replaces the running binary with it
+func install(ctx context.Context, rel Release, currentVersion string) (UpdateResult, error) {
+	installMu.Lock()
+	defer installMu.Unlock()
+
+	res := UpdateResult{
+		FromVersion: currentVersion,
+		ToVersion:   rel.Version,
+		Asset:       rel.Name,
+		Release:     rel,
+	}
+
+	if linkOS, linkArch := platform(); !DryRun && (linkOS != runtime.GOOS || linkArch != runtime.GOARCH) {
+		return res, fmt.Errorf("Cannot install a %s/%s binary on %s/%s", linkOS, linkArch, runtime.GOOS, runtime.GOARCH)
+	}
+
+	if PreUpdate != nil {
+		if err := PreUpdate(rel); err != nil {
+			return res, err
+		}
+	}
+
+	// get the binary to replace
+	oldExec, err := installPath()
+	if err != nil {
+		return res, err
+	}
+
+	// fail before downloading anything if the binary cannot be replaced,
+	// which a dry run does not do
+	if !DryRun {
+		if err := checkWritable(oldExec); err != nil {
+			return res, err
+		}
+	}
+
+	baseDir := TempDir
+	if baseDir == "" && !DryRun && !sameDevice(os.TempDir(), filepath.Dir(oldExec)) {
+		// extract next to the binary, avoiding cross-device renames and noexec temp mounts
+		baseDir = filepath.Dir(oldExec)
+	}
+
+	// each update uses its own temporary directory
+	tmpDir, err := ioutil.TempDir(baseDir, "ghru-")
+	if err != nil {
+		return res, err
+	}
+	if !KeepTempFiles {
+		defer os.RemoveAll(tmpDir)
+	}
+
+	dlFile := filepath.Join(tmpDir, rel.Name)
+
+	// download the checksum & signature alongside the release asset,
+	// cancelling all downloads if any of them fail
+	dlCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var checksum string
+	var signature []byte
+	var checksumErr, signatureErr error
+
+	// the asset digest is used instead of the checksums asset if available
+	if VerifyChecksum && rel.Digest == "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if checksum, checksumErr = fetchChecksum(dlCtx, rel); checksumErr != nil {
+				cancel()
+			}
+		}()
+	}
+
+	if len(PublicKey) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if signature, signatureErr = fetchSignature(dlCtx, rel); signatureErr != nil {
+				cancel()
+			}
+		}()
+	}
+
+	dlErr := downloadRelease(dlCtx, rel, dlFile)
+	if dlErr != nil {
+		cancel()
+	}
+
+	wg.Wait()
+
+	// report the cause of the cancellation rather than the cancellation
+	for _, err := range []error{checksumErr, signatureErr, dlErr} {
+		if err != nil {
+			return res, err
+		}
+	}
+
+	if fi, err := os.Stat(dlFile); err == nil {
+		res.Bytes = fi.Size()
+	}
+
+	if rel.Digest != "" {
+		if err := verifyDigest(rel, dlFile); err != nil {
+			os.Remove(dlFile)
+			return res, err
+		}
+	} else if VerifyChecksum {
+		if err := verifyChecksum(dlFile, rel.ChecksumAlgorithm, checksum); err != nil {
+			os.Remove(dlFile)
+			return res, err
+		}
+	}
+
+	if len(PublicKey) > 0 {
+		if err := verifySignature(rel, dlFile, signature); err != nil {
+			os.Remove(dlFile)
+			return res, err
+		}
+	}
+
+	// get src permissions
+	srcPerms := filePerms(oldExec)
+
+	newExec := dlFile
+
+	switch rel.FileType {
+	case "binary":
+		// uncompressed binary, nothing to extract
+		if err := os.Chmod(newExec, srcPerms); err != nil {
+			return res, err
+		}
+	default:
+		newExec = strings.TrimSuffix(dlFile, filepath.Ext(dlFile))
+		if err := decompress(ctx, dlFile, newExec, rel.FileType, srcPerms); err != nil {
+			return res, err
+		}
+
+		// remove the src file
+		if err := os.Remove(dlFile); err != nil {
+			return res, err
+		}
+	}
+
+	if err := verifyBinary(newExec); err != nil {
+		os.Remove(newExec)
+		return res, err
+	}
+
+	if len(VerifyCommand) > 0 {
+		if err := runVerifyCommand(ctx, newExec, rel); err != nil {
+			os.Remove(newExec)
+			return res, err
+		}
+	}
+
+	if DryRun {
+		return res, os.Remove(newExec)
+	}
+
+	if err := ReplaceFile(oldExec, newExec); err != nil {
+		return res, err
+	}
+
+	res.Updated = true
+	res.InstalledPath = oldExec
+	if _, err := os.Stat(backupPath(oldExec)); err == nil && KeepBackup {
+		res.BackupPath = backupPath(oldExec)
+	}
+
+	if OnUpdate != nil {
+		// the binary has already been replaced, so errors are only returned
+		return res, OnUpdate(currentVersion, rel)
+	}
+
+	return res, nil
+}
+
+// Uninstall removes the running binary, along with any backup and temporary
+// files left by updates. Windows does not allow a running binary to be
+// removed, so an error is returned on Windows.
+func Uninstall() error {
+	installMu.Lock()
+	defer installMu.Unlock()
+
+	exe, err := installPath()
+	if err != nil {
+		return err
+	}
+
+	if runtime.GOOS == "windows" && InstallPath == "" {
+		return fmt.Errorf("Cannot remove the running binary %s on Windows, remove it once the application has exited", exe)
+	}
+
+	if err := os.Remove(exe); err != nil {
+		return err
+	}
+
+	for _, f := range []string{backupPath(exe), exe + ".old", exe + ".new", exe + ".rollback"} {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RestartAfterUpdate restarts the application using the (updated) binary with
+// the same arguments and environment. On success it does not return.
+func RestartAfterUpdate() error {
+	exe, err := executable()
+	if err != nil {
+		return err
+	}
+
+	return restart(exe, os.Args, os.Environ())
+}
+
+// runVerifyCommand runs the new binary with the VerifyCommand arguments,
+// optionally checking that the output contains the release version
+func runVerifyCommand(ctx context.Context, file string, rel Release) error {
+	ctx, cancel := context.WithTimeout(ctx, verifyCommandTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, file, VerifyCommand...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Verification of the new binary failed: %s", err)
+	}
+
+	if ExpectVersionOutput && !strings.Contains(string(out), strings.TrimPrefix(rel.Version, "v")) {
+		return fmt.Errorf("Verification of the new binary failed: version %s not found in the output", rel.Version)
+	}
+
+	return nil
+}
+
+// executable returns the path of the running binary, resolving any symlinks
+// so the actual binary is replaced rather than the symlink to it
+func executable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+
+	return exe, nil
+}
+
+// installPath returns the path of the binary to update, which is the
+// InstallPath if set, otherwise the running binary
+func installPath() (string, error) {
+	if InstallPath == "" {
+		return executable()
+	}
+
+	path, err := filepath.Abs(InstallPath)
+	if err != nil {
+		return "", err
+	}
+
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	return path, nil
+}
+
+// checkWritable checks that the binary can be replaced, ie: that new files
+// can be created in its directory
+func checkWritable(file string) error {
+	f, err := ioutil.TempFile(filepath.Dir(file), ".ghru-")
+	if err != nil {
+		if os.IsPermission(err) {
+			return fmt.Errorf("Insufficient permissions to update %s, try running with elevated privileges", file)
+		}
+		return err
+	}
+
+	f.Close()
+
+	return os.Remove(f.Name())
+}
+
+// verifyBinary checks that the extracted release binary is a non-empty regular file
+func verifyBinary(file string) error {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return fmt.Errorf("Release binary not found after extraction: %s", err)
+	}
+
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("Release binary %s is not a regular file (%s)", file, fi.Mode())
+	}
+
+	if fi.Size() == 0 {
+		return fmt.Errorf("Release binary %s is empty", file)
+	}
+
+	return nil
+}
+
+// Extract decompresses a bz2 or gz compressed file into destDir, detecting the
+// format from the file extension, and returns the list of extracted files.
+// Uncompressed files are copied as-is. Extracted files are made executable.
+func Extract(archivePath, destDir string) ([]string, error) {
+	fileType := detectFileType(archivePath)
+	if fileType == "unsupported" {
+		return nil, fmt.Errorf("Unsupported archive %s, expected a bz2 or gz compressed file", filepath.Base(archivePath))
+	}
+
+	filename := filepath.Base(archivePath)
+	if fileType != "binary" {
+		filename = strings.TrimSuffix(filename, filepath.Ext(filename))
+	}
+
+	dst := filepath.Join(destDir, filename)
+
+	if fileType == "binary" {
+		// copying a file onto itself would truncate it
+		srcAbs, srcErr := filepath.Abs(archivePath)
+		dstAbs, dstErr := filepath.Abs(dst)
+		if srcErr != nil || dstErr != nil || srcAbs != dstAbs {
+			if err := copyFile(archivePath, dst); err != nil {
+				return nil, err
+			}
+		}
+
+		// downloaded files are not executable
+		if err := os.Chmod(dst, 0755); err != nil {
+			return nil, err
+		}
+	} else if err := decompress(context.Background(), archivePath, dst, fileType, 0755); err != nil {
+		return nil, err
+	}
+
+	return []string{dst}, nil
+}
+
+// decompress extracts the bz2 or gz compressed src file to dst with
+// the given permissions
+func decompress(ctx context.Context, src, dst, fileType string, perm os.FileMode) error {
+	// open the compressed file
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader
+	switch fileType {
+	case "bz2":
+		r = bzip2.NewReader(f)
+	case "gz":
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	default:
+		return fmt.Errorf("Unsupported file type: %s", fileType)
+	}
+
+	// write the file
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_RDWR|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
 
-	"github.com/axllent/semver"
-)
+	if MaxExtractSize > 0 {
+		// read one byte more than allowed to detect oversized files
+		r = io.LimitReader(r, MaxExtractSize+1)
+	}
 
-// AllowPrereleases defines whether pre-releases may be included
-var AllowPrereleases = false
+	n, err := io.Copy(out, &contextReader{ctx, r})
+	if err == nil && MaxExtractSize > 0 && n > MaxExtractSize {
+		err = fmt.Errorf("Decompressed file exceeds the maximum size of %d bytes", MaxExtractSize)
+	}
 
-// Releases struct for Github releases json
-type Releases []struct {
-	Name       string `json:"name"`       // release name
-	Tag        string `json:"tag_name"`   // release tag
-	Prerelease bool   `json:"prerelease"` // Github pre-release
-	Assets     []struct {
-		BrowserDownloadURL string `json:"browser_download_url"`
-		ID                 int64  `json:"id"`
-		Name               string `json:"name"`
-		Size               int64  `json:"size"`
-	} `json:"assets"`
+	// close immediately else Windows has a fit
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		// the mode is not applied to existing files, and is subject to the umask
+		err = os.Chmod(dst, perm)
+	}
+
+	if err != nil {
+		// remove the partially extracted file
+		os.Remove(dst)
+	}
+
+	return err
 }
 
-// Release struct contains the file data for downloadable release
-type Release struct {
-	Name string
-	Tag  string
-	URL  string
-	Size int64
+// Open downloads the release asset, returning a stream of the decompressed
+// binary which must be closed. The binary is not written to disk, and checksums
+// and signatures are not verified.
+func Open(rel Release) (io.ReadCloser, error) {
+	return OpenContext(context.Background(), rel)
 }
 
-// Latest fetches the latest release info & returns release tag, filename & download url
-func Latest(repo, name string) (string, string, string, error) {
-	releaseURL := fmt.Sprintf("https://api.github.com/repos/%s/releases", repo)
+// OpenContext is like Open, but the download can be cancelled via the context
+func OpenContext(ctx context.Context, rel Release) (io.ReadCloser, error) {
+	ctx, cancel := withTimeout(ctx, DownloadTimeout)
 
-	resp, err := http.Get(releaseURL)
+	resp, err := httpGet(ctx, rel.URL, "application/octet-stream")
 	if err != nil {
-		return "", "", "", err
+		cancel()
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
+	rc := &releaseReader{closers: []io.Closer{resp.Body}, cancel: cancel}
 
-	if err != nil {
-		return "", "", "", err
+	switch rel.FileType {
+	case "bz2":
+		rc.r = bzip2.NewReader(resp.Body)
+	case "gz":
+		gr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		rc.r = gr
+		rc.closers = append([]io.Closer{gr}, rc.closers...)
+	default:
+		rc.r = resp.Body
 	}
 
-	linkOS := runtime.GOOS
-	linkArch := runtime.GOARCH
-	linkExt := ""
-	if linkOS == "windows" {
-		linkExt = ".exe"
+	if MaxExtractSize > 0 && rel.FileType != "binary" {
+		rc.r = &maxSizeReader{r: rc.r, n: MaxExtractSize}
 	}
 
-	var allReleases = []Release{}
+	return rc, nil
+}
 
-	var releases Releases
+// releaseReader is the decompressed stream of a release asset
+type releaseReader struct {
+	r       io.Reader
+	closers []io.Closer
+	cancel  context.CancelFunc
+}
 
-	json.Unmarshal(body, &releases)
+// Read implements io.Reader
+func (rr *releaseReader) Read(p []byte) (int, error) {
+	return rr.r.Read(p)
+}
 
-	// loop through releases
-	for _, r := range releases {
-		if !semver.IsValid(r.Tag) {
-			// Invalid semversion, skip
-			continue
-		}
+// Close closes the decompressor & download
+func (rr *releaseReader) Close() error {
+	defer rr.cancel()
 
-		if !AllowPrereleases && (semver.Prerelease(r.Tag) != "" || r.Prerelease) {
-			// we don't accept AllowPrereleases, skip
-			continue
+	var err error
+	for _, c := range rr.closers {
+		if cerr := c.Close(); err == nil {
+			err = cerr
 		}
+	}
 
-		binaryName := fmt.Sprintf("%s_%s_%s_%s%s.bz2", name, r.Tag, linkOS, linkArch, linkExt)
+	return err
+}
 
-		for _, a := range r.Assets {
-			if a.Name == binaryName {
-				thisRelease := Release{a.Name, r.Tag, a.BrowserDownloadURL, a.Size}
-				allReleases = append(allReleases, thisRelease)
-				break
-			}
-		}
-	}
+// maxSizeReader returns an error once more than n bytes are read
+type maxSizeReader struct {
+	r io.Reader
+	n int64
+}
 
-	if len(allReleases) == 0 {
-		// no releases with suitable assets found
-		return "", "", "", fmt.Errorf("No binary releases found")
+// Read implements io.Reader
+func (m *maxSizeReader) Read(p []byte) (int, error) {
+	n, err := m.r.Read(p)
+	m.n -= int64(n)
+	if m.n < 0 {
+		return n, fmt.Errorf("Decompressed file exceeds the maximum size of %d bytes", MaxExtractSize)
 	}
 
-	var latestRelease = Release{}
+	return n, err
+}
 
-	for _, r := range allReleases {
-		// detect the latest release
-		if semver.Compare(r.Tag, latestRelease.Tag) == 1 {
-			latestRelease = r
+// DownloadToFile downloads a URL to a file
+func DownloadToFile(url, filepath string) error {
+	return downloadToFile(context.Background(), url, filepath, 0)
+}
+
+// downloadRelease downloads the release asset to a file, falling back to
+// the MirrorURLs if the download fails
+func downloadRelease(ctx context.Context, rel Release, file string) error {
+	err := downloadToFile(ctx, rel.URL, file, rel.Size)
+
+	for _, mirror := range MirrorURLs {
+		if err == nil || ctx.Err() != nil {
+			break
 		}
+
+		url := fmt.Sprintf("%s/%s/%s", strings.TrimRight(mirror, "/"), rel.Tag, rel.Name)
+		err = downloadToFile(ctx, url, file, rel.Size)
 	}
 
-	return latestRelease.Tag, latestRelease.Name, latestRelease.URL, nil
+	return err
 }
 
-// GreaterThan compares the current version to a different version
-// returning < 1 not upgradeable
-func GreaterThan(toVer, fromVer string) bool {
-	return semver.Compare(toVer, fromVer) == 1
+// downloadToFile downloads a URL to a file, aborting if the context is cancelled.
+// The size is the expected file size (0 if unknown), which the downloaded file
+// is verified against, and is used for progress reporting if the server does
+// not return a Content-Length. Retries resume the partial download.
+func downloadToFile(ctx context.Context, url, filepath string, size int64) error {
+	// a partial download from a previous call may be of a different file
+	if err := os.Remove(filepath + ".part"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return withRetry(ctx, func() error {
+		dlCtx, cancel := withTimeout(ctx, DownloadTimeout)
+		defer cancel()
+
+		return download(dlCtx, url, filepath, size)
+	})
 }
 
-// Update the running binary with the latest release binary from Github
-func Update(repo, appName, currentVersion string) (string, error) {
-	ver, filename, downloadURL, err := Latest(repo, appName)
+// download performs a single download attempt of a URL to a file. The data is
+// written to <file>.part, which is only renamed once the download completes.
+// A partial download of a previous attempt is resumed with a ranged request if
+// possible.
+func download(ctx context.Context, url, filepath string, size int64) error {
+	partFile := filepath + ".part"
 
-	if err != nil {
-		return "", err
+	var offset int64
+	if fi, err := os.Stat(partFile); err == nil {
+		offset = fi.Size()
 	}
 
-	if ver == currentVersion {
-		return "", fmt.Errorf("No new release found")
+	if size > 0 && offset == size {
+		// previously completed
+		return os.Rename(partFile, filepath)
 	}
 
-	if semver.Compare(ver, currentVersion) < 1 {
-		return "", fmt.Errorf("No newer releases found (latest %s)", ver)
+	if size > 0 && offset > size {
+		offset = 0
 	}
 
-	tmpDir := os.TempDir()
-	bz2File := filepath.Join(tmpDir, filename)
-	extractedFile := strings.TrimSuffix(bz2File, ".bz2")
+	req, err := newRequest(ctx, url, "application/octet-stream")
+	if err != nil {
+		return err
+	}
 
-	if err := DownloadToFile(downloadURL, bz2File); err != nil {
-		return "", err
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
 	}
 
-	// open the bz2
-	f, err := os.OpenFile(bz2File, 0, 0)
+	// Get the data
+	resp, err := doRequest(req)
 	if err != nil {
-		return "", err
+		return err
 	}
+	defer resp.Body.Close()
 
-	// create a bzip2 reader
-	br := bzip2.NewReader(f)
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resp.StatusCode == http.StatusPartialContent {
+		// append to the partial download
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	} else {
+		// ranges not supported, download the full file
+		offset = 0
+	}
 
-	// get the running binary
-	oldExec, err := os.Executable()
+	// Create the file
+	out, err := os.OpenFile(partFile, flags, 0644)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	// get src permissions
-	fi, _ := os.Stat(oldExec)
-	srcPerms := fi.Mode().Perm()
+	var w io.Writer = out
+	if ProgressFunc != nil {
+		total := size
+		if resp.ContentLength > 0 {
+			total = offset + resp.ContentLength
+		}
+		w = &progressWriter{w: out, downloaded: offset, total: total, lastTime: time.Now(), lastBytes: offset}
+	}
 
-	// write the file
-	out, err := os.OpenFile(extractedFile, os.O_CREATE|os.O_RDWR, srcPerms)
-	if err != nil {
-		return "", err
+	// Write the body to file
+	n, err := io.Copy(w, &contextReader{ctx, resp.Body})
+
+	if cerr := out.Close(); err == nil {
+		err = cerr
 	}
 
-	_, err = io.Copy(out, br)
 	if err != nil {
-		return "", err
+		// keep the partial download so it can be resumed
+		return err
 	}
 
-	// close immediately else Windows has a fit
-	f.Close()
-	out.Close()
+	if size > 0 && offset+n != size {
+		os.Remove(partFile)
+		return fmt.Errorf("Downloaded %d bytes, expected %d bytes", offset+n, size)
+	}
 
-	if err = ReplaceFile(oldExec, extractedFile); err != nil {
-		return "", err
+	return os.Rename(partFile, filepath)
+}
+
+// contextReader is an io.Reader which stops reading once the context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read implements io.Reader
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
 	}
 
-	// remove the src file
-	if err := os.Remove(bz2File); err != nil {
-		return "", err
+	return c.r.Read(p)
+}
+
+// progressSampleInterval is the minimum interval between download speed samples
+const progressSampleInterval = 250 * time.Millisecond
+
+// progressWriter is an io.Writer which reports the progress to ProgressFunc
+type progressWriter struct {
+	w          io.Writer
+	downloaded int64
+	total      int64
+
+	// the last speed sample, and the moving average speed
+	lastTime  time.Time
+	lastBytes int64
+	speed     float64
+}
+
+// Write implements io.Writer
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.downloaded += int64(n)
+
+	if elapsed := time.Since(p.lastTime); elapsed >= progressSampleInterval {
+		sample := float64(p.downloaded-p.lastBytes) / elapsed.Seconds()
+		if p.speed == 0 {
+			p.speed = sample
+		} else {
+			// exponential moving average to smooth out fluctuations
+			p.speed = 0.3*sample + 0.7*p.speed
+		}
+		p.lastTime = time.Now()
+		p.lastBytes = p.downloaded
+	}
+
+	info := ProgressInfo{Downloaded: p.downloaded, Total: p.total, BytesPerSecond: p.speed}
+	if p.total > p.downloaded && p.speed > 0 {
+		info.ETA = time.Duration(float64(p.total-p.downloaded) / p.speed * float64(time.Second))
 	}
 
-	return ver, nil
+	ProgressFunc(info)
+
+	return n, err
 }
 
-// DownloadToFile downloads a URL to a file
-func DownloadToFile(url, filepath string) error {
-	// Get the data
-	resp, err := http.Get(url)
+// logf calls the Logger if set
+func logf(format string, v ...interface{}) {
+	if Logger != nil {
+		Logger(format, v...)
+	}
+}
+
+// apiURL returns the Github API base URL without a trailing slash
+func apiURL() string {
+	base := strings.TrimRight(BaseURL, "/")
+	if base == "" {
+		return "https://api.github.com"
+	}
+
+	return base
+}
+
+// withTimeout returns a context with the timeout applied. The timeout is
+// ignored if zero, or if a custom HTTPClient (with its own timeout) is used.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 || HTTPClient != nil {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// httpClient returns the HTTP client to use for requests
+func httpClient() *http.Client {
+	if HTTPClient != nil {
+		return HTTPClient
+	}
+
+	return defaultClient
+}
+
+// newDefaultClient returns a HTTP client which uses the proxy defined by the
+// environment, regardless of changes to http.DefaultTransport
+func newDefaultClient() *http.Client {
+	var transport *http.Transport
+	if t, ok := http.DefaultTransport.(*http.Transport); ok {
+		transport = t.Clone()
+	} else {
+		transport = &http.Transport{}
+	}
+
+	transport.Proxy = http.ProxyFromEnvironment
+
+	return &http.Client{Transport: transport}
+}
+
+// httpGet performs a GET request with the given Accept header
+func httpGet(ctx context.Context, url, accept string) (*http.Response, error) {
+	req, err := newRequest(ctx, url, accept)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	// Create the file
-	out, err := os.Create(filepath)
+	return doRequest(req)
+}
+
+// newRequest returns a GET request with the given Accept header. The Token
+// is only sent to the Github API, never to third-party download hosts.
+func newRequest(ctx context.Context, url, accept string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer out.Close()
 
-	// Write the body to file
-	_, err = io.Copy(out, resp.Body)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
 
-	return err
+	if UserAgent != "" {
+		req.Header.Set("User-Agent", UserAgent)
+	}
+
+	if Token != "" && strings.HasPrefix(url, apiURL()+"/") {
+		req.Header.Set("Authorization", "Bearer "+Token)
+	}
+
+	return req, nil
+}
+
+// doRequest performs a request, returning an error for unsuccessful responses
+func doRequest(req *http.Request) (*http.Response, error) {
+	client := httpClient()
+
+	// asset downloads (including checksums & signatures) are requested as
+	// application/octet-stream, and are restricted to the allowed hosts
+	if len(AllowedDownloadHosts) > 0 && req.Header.Get("Accept") == "application/octet-stream" {
+		if err := checkDownloadHost(req.URL); err != nil {
+			return nil, err
+		}
+
+		c := *client
+		prev := client.CheckRedirect
+		c.CheckRedirect = func(r *http.Request, via []*http.Request) error {
+			if err := checkDownloadHost(r.URL); err != nil {
+				return err
+			}
+			if prev != nil {
+				return prev(r, via)
+			}
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return nil
+		}
+		client = &c
+	}
+
+	do := client.Do
+	if req.URL.Scheme == "file" {
+		do = localRoundTrip
+	}
+
+	resp, err := do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests) &&
+		resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		resp.Body.Close()
+		reset, _ := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+		return nil, &RateLimitError{Reset: time.Unix(reset, 0)}
+	}
+
+	if (resp.StatusCode < 200 || resp.StatusCode >= 300) && resp.StatusCode != http.StatusNotModified {
+		// include the start of the response body to aid debugging
+		snippet, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 256))
+		resp.Body.Close()
+		return nil, &statusError{resp.StatusCode, strings.TrimSpace(string(snippet))}
+	}
+
+	return resp, nil
+}
+
+// checkJSON returns an error if the response is not JSON, eg: an HTML error page
+// of a proxy or firewall, including the start of the response body
+func checkJSON(resp *http.Response) error {
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if contentType == "" || mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+		return nil
+	}
+
+	snippet, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 256))
+
+	return fmt.Errorf("Expected a JSON response, got %s (status %d): %s",
+		contentType, resp.StatusCode, strings.Join(strings.Fields(string(snippet)), " "))
+}
+
+// checkDownloadHost returns an error if the URL host is not one of the
+// AllowedDownloadHosts or the Github API host
+func checkDownloadHost(u *url.URL) error {
+	if u.Scheme == "file" {
+		return nil
+	}
+
+	allowed := append([]string{}, AllowedDownloadHosts...)
+	if api, err := url.Parse(apiURL()); err == nil {
+		allowed = append(allowed, api.Hostname())
+	}
+
+	for _, host := range allowed {
+		if strings.EqualFold(u.Hostname(), host) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrHostNotAllowed, u.Hostname())
 }
 
 // ReplaceFile replaces one file with another.
@@ -211,8 +2190,15 @@ func DownloadToFile(url, filepath string) error {
 // and the new binary saved to the original path. This requires
 // read & write permissions to both the original file and directory.
 // Note, on Windows it is not possible to delete a running program,
-// so the old exe is renamed and moved to os.TempDir()
+// so the old exe is renamed to <binary>.old and removed once possible.
+// If KeepBackup is set, the old binary is kept as <binary>.bak
+// (on Windows <binary>.old is the backup).
 func ReplaceFile(dst, src string) error {
+	return replaceFile(dst, src, KeepBackup)
+}
+
+// replaceFile replaces one file with another, optionally keeping a backup
+func replaceFile(dst, src string, backup bool) error {
 	// open the source file for reading
 	source, err := os.Open(src)
 	if err != nil {
@@ -233,11 +2219,10 @@ func ReplaceFile(dst, src string) error {
 	oldTmpAbs := filepath.Join(dstDir, dstOld)
 
 	// get src permissions
-	fi, _ := os.Stat(dst)
-	srcPerms := fi.Mode().Perm()
+	srcPerms := filePerms(dst)
 
 	// create the new file
-	tmpNew, err := os.OpenFile(newTmpAbs, os.O_CREATE|os.O_RDWR, srcPerms)
+	tmpNew, err := os.OpenFile(newTmpAbs, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, srcPerms)
 	if err != nil {
 		return err
 	}
@@ -251,24 +2236,42 @@ func ReplaceFile(dst, src string) error {
 	tmpNew.Close()
 	source.Close()
 
+	// keep the owner & group so the binary works under the same (service) account
+	fi, err := os.Stat(dst)
+	if err == nil {
+		preserveOwner(newTmpAbs, fi)
+	} else if os.IsNotExist(err) {
+		// nothing to replace, eg: a new InstallPath
+		if err := rename(newTmpAbs, dst); err != nil {
+			return err
+		}
+
+		return os.Remove(src)
+	}
+
 	// rename the current executable to <binary>.old
-	if err := os.Rename(dst, oldTmpAbs); err != nil {
+	if err := rename(dst, oldTmpAbs); err != nil {
 		return err
 	}
 
 	// rename the <binary>.new to current executable
-	if err := os.Rename(newTmpAbs, dst); err != nil {
+	if err := rename(newTmpAbs, dst); err != nil {
 		return err
 	}
 
-	// delete the old binary
-	if runtime.GOOS == "windows" {
-		tmpDir := os.TempDir()
-		delFile := filepath.Join(tmpDir, filepath.Base(oldTmpAbs))
-		if err := os.Rename(oldTmpAbs, delFile); err != nil {
-			return err
+	// delete (or keep) the old binary
+	switch {
+	case backup:
+		if oldTmpAbs != backupPath(dst) {
+			if err := renameFile(oldTmpAbs, backupPath(dst)); err != nil {
+				return err
+			}
 		}
-	} else {
+	case runtime.GOOS == "windows":
+		// the running binary cannot be deleted on Windows until it exits,
+		// so it is kept next to the binary rather than moved across volumes
+		removeLater(oldTmpAbs)
+	default:
 		if err := os.Remove(oldTmpAbs); err != nil {
 			return err
 		}
@@ -281,3 +2284,98 @@ func ReplaceFile(dst, src string) error {
 
 	return nil
 }
+
+// filePerms returns the permissions of a file, or 0755 if it cannot be read
+func filePerms(file string) os.FileMode {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return 0755
+	}
+
+	return fi.Mode().Perm()
+}
+
+// backupPath returns the path the previous binary is moved to when replaced.
+// On Windows this is the <binary>.old the running binary is renamed to.
+func backupPath(dst string) string {
+	if runtime.GOOS == "windows" {
+		return dst + ".old"
+	}
+
+	return dst + ".bak"
+}
+
+// Rollback restores the previous binary kept by an update with KeepBackup.
+// This requires write permission to the install directory.
+func Rollback() error {
+	installMu.Lock()
+	defer installMu.Unlock()
+
+	exe, err := installPath()
+	if err != nil {
+		return err
+	}
+
+	backup := backupPath(exe)
+
+	if _, err := os.Stat(backup); err != nil {
+		return fmt.Errorf("No backup found to roll back to: %s", err)
+	}
+
+	// copy the backup as it is overwritten on Windows when replacing the running binary
+	restore := exe + ".rollback"
+	if err := copyFile(backup, restore); err != nil {
+		return err
+	}
+
+	if err := replaceFile(exe, restore, false); err != nil {
+		return err
+	}
+
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	return os.Remove(backup)
+}
+
+// renameFile renames (moves) a file, falling back to copying and removing
+// the src file if they are on different devices
+func renameFile(src, dst string) error {
+	err := rename(src, dst)
+	if err == nil || !isCrossDevice(err) {
+		return err
+	}
+
+	if err := copyFile(src, dst); err != nil {
+		return err
+	}
+
+	return os.Remove(src)
+}
+
+// copyFile copies the src file to dst, preserving the file permissions
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
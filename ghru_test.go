@@ -0,0 +1,606 @@
+package ghru
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testBinary is the content of the test release binaries
+var testBinary = []byte("#!/bin/sh\necho ghru\n")
+
+// proxyRequests are the URLs requested via the test proxy
+var proxyRequests struct {
+	sync.Mutex
+	urls []string
+}
+
+func TestMain(m *testing.M) {
+	// the proxy environment is only read once, so must be set before any requests
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxyRequests.Lock()
+		proxyRequests.urls = append(proxyRequests.urls, r.URL.String())
+		proxyRequests.Unlock()
+
+		releasesHandler(testReleases("http://ghru.invalid")).ServeHTTP(w, r)
+	}))
+
+	os.Setenv("HTTP_PROXY", proxy.URL)
+	os.Setenv("NO_PROXY", "")
+	os.Setenv("no_proxy", "")
+
+	code := m.Run()
+
+	proxy.Close()
+	os.Exit(code)
+}
+
+// testAsset returns a gzip compressed release asset of the version for the
+// running platform
+func testAsset(baseURL, version string) map[string]interface{} {
+	name := fmt.Sprintf("myapp_%s_%s_%s.gz", version, runtime.GOOS, runtime.GOARCH)
+
+	return map[string]interface{}{
+		"name":                 name,
+		"browser_download_url": baseURL + "/download/" + name,
+		"id":                   1,
+		"content_type":         "application/gzip",
+	}
+}
+
+// testGzip returns the gzip compressed testBinary
+func testGzip() []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(testBinary)
+	zw.Close()
+
+	return buf.Bytes()
+}
+
+// testReleases returns a list of releases in the format of the Github API
+func testReleases(baseURL string) []map[string]interface{} {
+	return []map[string]interface{}{
+		{"tag_name": "1.2.0", "assets": []map[string]interface{}{testAsset(baseURL, "1.2.0")}},
+		{"tag_name": "1.1.0", "assets": []map[string]interface{}{testAsset(baseURL, "1.1.0")}},
+	}
+}
+
+// releasesHandler serves the releases (most recently published first), and
+// the gzip compressed testBinary for any download
+func releasesHandler(releases []map[string]interface{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/releases"):
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(releases)
+		case strings.HasSuffix(r.URL.Path, "/releases/latest"):
+			// the most recently published (first) stable release
+			for _, rel := range releases {
+				if rel["draft"] == nil && rel["prerelease"] == nil {
+					w.Header().Set("Content-Type", "application/json")
+					json.NewEncoder(w).Encode(rel)
+					return
+				}
+			}
+			http.NotFound(w, r)
+		case strings.HasPrefix(r.URL.Path, "/download/"):
+			w.Write(testGzip())
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// testServer starts a Github API server serving the releases returned by fn,
+// which is given the server URL, and sets the BaseURL until reset is called
+func testServer(fn func(baseURL string) []map[string]interface{}) (reset func()) {
+	var releases []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		releasesHandler(releases).ServeHTTP(w, r)
+	}))
+	releases = fn(srv.URL)
+
+	baseURL := BaseURL
+	BaseURL = srv.URL
+
+	return func() {
+		BaseURL = baseURL
+		srv.Close()
+	}
+}
+
+func TestLatestSkipsDrafts(t *testing.T) {
+	defer testServer(func(baseURL string) []map[string]interface{} {
+		return append([]map[string]interface{}{
+			{"tag_name": "2.0.0", "draft": true, "assets": []map[string]interface{}{testAsset(baseURL, "2.0.0")}},
+		}, testReleases(baseURL)...)
+	})()
+
+	tag, _, _, err := Latest("axllent/myapp", "myapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tag != "1.2.0" {
+		t.Errorf("expected the latest release 1.2.0, got %s", tag)
+	}
+}
+
+func TestVersionPrefix(t *testing.T) {
+	DryRun = true
+	defer func() { DryRun = false }()
+
+	for _, prefix := range []string{"", "v"} {
+		reset := testServer(func(baseURL string) []map[string]interface{} {
+			return []map[string]interface{}{
+				{"tag_name": prefix + "1.2.0", "assets": []map[string]interface{}{testAsset(baseURL, prefix+"1.2.0")}},
+				{"tag_name": prefix + "1.1.0", "assets": []map[string]interface{}{testAsset(baseURL, prefix+"1.1.0")}},
+			}
+		})
+
+		asset := fmt.Sprintf("myapp_%s1.2.0_%s_%s.gz", prefix, runtime.GOOS, runtime.GOARCH)
+
+		tag, name, _, err := Latest("axllent/myapp", "myapp")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if tag != prefix+"1.2.0" || name != asset {
+			t.Errorf("expected %s1.2.0 %s, got %s %s", prefix, asset, tag, name)
+		}
+
+		for _, current := range []string{"1.1.0", "v1.1.0"} {
+			res, err := SelfUpdate("axllent/myapp", "myapp", current)
+			if err != nil {
+				t.Fatalf("tag %s1.2.0, current %s: %v", prefix, current, err)
+			}
+
+			if res.ToVersion != prefix+"1.2.0" || res.Asset != asset || res.FromPrerelease {
+				t.Errorf("tag %s1.2.0, current %s: expected %s1.2.0 %s, got %+v", prefix, current, prefix, asset, res)
+			}
+		}
+
+		for _, current := range []string{"1.2.0", "v1.2.0"} {
+			if _, err := SelfUpdate("axllent/myapp", "myapp", current); !errors.Is(err, ErrUpToDate) {
+				t.Errorf("tag %s1.2.0, current %s: expected ErrUpToDate, got %v", prefix, current, err)
+			}
+		}
+
+		reset()
+	}
+}
+
+func TestMinReleaseAge(t *testing.T) {
+	published := time.Date(2024, 11, 5, 12, 0, 0, 0, time.UTC)
+	defer testServer(func(baseURL string) []map[string]interface{} {
+		releases := testReleases(baseURL)
+		releases[0]["published_at"] = published
+		releases[1]["published_at"] = published.Add(-48 * time.Hour)
+		return releases
+	})()
+
+	MinReleaseAge = 24 * time.Hour
+	defer func() {
+		MinReleaseAge = 0
+		now = time.Now
+	}()
+
+	now = func() time.Time { return published.Add(time.Hour) }
+
+	tag, _, _, err := Latest("axllent/myapp", "myapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tag != "1.1.0" {
+		t.Errorf("expected 1.2.0 to be held back, got %s", tag)
+	}
+
+	// releases are still listed
+	releases, err := ListReleases("axllent/myapp", "myapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(releases) != 2 {
+		t.Errorf("expected 2 releases, got %d", len(releases))
+	}
+
+	notes, err := ReleaseNotesSince("axllent/myapp", "myapp", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(notes) != 2 {
+		t.Errorf("expected 2 releases since 1.0.0, got %d", len(notes))
+	}
+
+	now = func() time.Time { return published.Add(MinReleaseAge) }
+
+	tag, _, _, err = Latest("axllent/myapp", "myapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tag != "1.2.0" {
+		t.Errorf("expected 1.2.0 after %s, got %s", MinReleaseAge, tag)
+	}
+}
+
+func TestLocalAssetURL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ghru-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	releases, err := json.Marshal(testReleases("https://github.com/axllent/myapp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "releases.json"), releases, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	relDir, err := filepath.Rel(wd, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseURL := BaseURL
+	defer func() { BaseURL = baseURL }()
+
+	name := fmt.Sprintf("myapp_1.2.0_%s_%s.gz", runtime.GOOS, runtime.GOARCH)
+
+	for _, BaseURL = range []string{dir, relDir, "file:///" + strings.TrimPrefix(filepath.ToSlash(dir), "/")} {
+		assetURL, err := AssetURL("axllent/myapp", "myapp", "")
+		if err != nil {
+			t.Fatalf("%s: %v", BaseURL, err)
+		}
+
+		u, err := url.Parse(assetURL)
+		if err != nil {
+			t.Fatalf("%s: %v", BaseURL, err)
+		}
+
+		path := strings.TrimPrefix(u.Path, "/")
+		if runtime.GOOS != "windows" {
+			path = "/" + path
+		}
+
+		if u.Scheme != "file" || filepath.FromSlash(path) != filepath.Join(dir, name) {
+			t.Errorf("%s: expected the file:// url of %s, got %s", BaseURL, filepath.Join(dir, name), assetURL)
+		}
+	}
+}
+
+func TestDefaultClientProxy(t *testing.T) {
+	baseURL := BaseURL
+	BaseURL = "http://ghru.invalid"
+	defer func() { BaseURL = baseURL }()
+
+	tag, _, _, err := Latest("axllent/myapp", "myapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tag != "1.2.0" {
+		t.Errorf("expected the latest release 1.2.0, got %s", tag)
+	}
+
+	proxyRequests.Lock()
+	defer proxyRequests.Unlock()
+
+	if len(proxyRequests.urls) == 0 || !strings.HasPrefix(proxyRequests.urls[0], "http://ghru.invalid/repos/axllent/myapp/releases") {
+		t.Errorf("expected the request to use HTTP_PROXY, got %v", proxyRequests.urls)
+	}
+}
+
+func TestArchivesNotInstalled(t *testing.T) {
+	defer testServer(func(baseURL string) []map[string]interface{} {
+		return []map[string]interface{}{
+			{"tag_name": "1.2.0", "assets": []map[string]interface{}{
+				{"name": "installer.tar.gz", "browser_download_url": baseURL + "/download/installer.tar.gz", "id": 2},
+			}},
+		}
+	})()
+
+	AssetName = "installer.tar.gz"
+	_, _, _, err := Latest("axllent/myapp", "myapp")
+	AssetName = ""
+	if err == nil || !strings.Contains(err.Error(), "archives are not supported") {
+		t.Errorf("expected an unsupported AssetName error, got %v", err)
+	}
+
+	AssetPattern = `installer\..*`
+	_, _, _, err = Latest("axllent/myapp", "myapp")
+	AssetPattern = ""
+	if !errors.Is(err, ErrNoMatchingAsset) || !strings.Contains(err.Error(), "archives are not supported") {
+		t.Errorf("expected ErrNoMatchingAsset for an archive, got %v", err)
+	}
+}
+
+func TestDownloadToFileIgnoresStalePartial(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "ghru-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "file")
+
+	for _, stale := range [][]byte{[]byte("stale data"), bytes.Repeat([]byte("x"), 200)} {
+		if err := ioutil.WriteFile(file+".part", stale, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := DownloadToFile(srv.URL, file); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(b, content) {
+			t.Errorf("expected the downloaded file to be replaced, got %q", b)
+		}
+	}
+}
+
+func TestLatestIsHighestVersion(t *testing.T) {
+	// a backport published after a newer major version
+	defer testServer(func(baseURL string) []map[string]interface{} {
+		return []map[string]interface{}{
+			{"tag_name": "1.9.9", "assets": []map[string]interface{}{testAsset(baseURL, "1.9.9")}},
+			{"tag_name": "2.0.0", "assets": []map[string]interface{}{testAsset(baseURL, "2.0.0")}},
+		}
+	})()
+
+	rel, ok, err := HasUpdate("axllent/myapp", "myapp", "1.5.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok || rel.Version != "2.0.0" {
+		t.Errorf("expected an update to 2.0.0, got %s", rel.Version)
+	}
+}
+
+func TestDryRunNotWritable(t *testing.T) {
+	defer testServer(testReleases)()
+
+	dir, err := ioutil.TempDir("", "ghru-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the install directory does not exist, so cannot be written to
+	InstallPath = filepath.Join(dir, "missing", "myapp")
+	DryRun = true
+	defer func() {
+		InstallPath = ""
+		DryRun = false
+	}()
+
+	res, err := SelfUpdate("axllent/myapp", "myapp", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Updated || res.ToVersion != "1.2.0" {
+		t.Errorf("expected a dry run of 1.2.0, got %+v", res)
+	}
+}
+
+func TestAllowedDownloadHostsRedirect(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/allowed":
+			http.Redirect(w, r, srv.URL+"/file", http.StatusFound)
+		case "/denied":
+			// the same server, but a host which is not allowed
+			http.Redirect(w, r, strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)+"/file", http.StatusFound)
+		case "/file":
+			w.Write(testBinary)
+		}
+	}))
+	defer srv.Close()
+
+	AllowedDownloadHosts = []string{"127.0.0.1"}
+	defer func() { AllowedDownloadHosts = []string{} }()
+
+	dir, err := ioutil.TempDir("", "ghru-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := DownloadToFile(srv.URL+"/allowed", filepath.Join(dir, "allowed")); err != nil {
+		t.Errorf("expected the redirect to an allowed host to be followed, got %v", err)
+	}
+
+	if err := DownloadToFile(srv.URL+"/denied", filepath.Join(dir, "denied")); !errors.Is(err, ErrHostNotAllowed) {
+		t.Errorf("expected ErrHostNotAllowed for the redirect, got %v", err)
+	}
+}
+
+func TestExtractUncompressedInPlace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ghru-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "myapp")
+	if err := ioutil.WriteFile(file, testBinary, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := Extract(file, dir+string(filepath.Separator)+".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 {
+		t.Fatalf("expected 1 extracted file, got %v", files)
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(b, testBinary) {
+		t.Errorf("expected the file to be unchanged, got %q", b)
+	}
+}
+
+// assetServer serves a release with checksums & minisign signature assets,
+// calling handle before serving each asset, and sets the BaseURL & PublicKey
+// until reset is called
+func assetServer(handle func(w http.ResponseWriter, r *http.Request) bool) (reset func()) {
+	asset := testGzip()
+	sum := sha256.Sum256(asset)
+
+	seed := make([]byte, ed25519.SeedSize)
+	privateKey := ed25519.NewKeyFromSeed(seed)
+
+	var name string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/download/") {
+			releasesHandler([]map[string]interface{}{{"tag_name": "1.2.0", "assets": []map[string]interface{}{
+				testAsset("http://"+r.Host, "1.2.0"),
+				{"name": "checksums.txt", "browser_download_url": "http://" + r.Host + "/download/checksums.txt", "id": 2},
+				{"name": name + ".minisig", "browser_download_url": "http://" + r.Host + "/download/" + name + ".minisig", "id": 3},
+			}}}).ServeHTTP(w, r)
+			return
+		}
+
+		if !handle(w, r) {
+			return
+		}
+
+		switch strings.TrimPrefix(r.URL.Path, "/download/") {
+		case "checksums.txt":
+			fmt.Fprintf(w, "%x  %s\n", sum, name)
+		case name + ".minisig":
+			w.Write(minisignSign(privateKey, asset))
+		case name:
+			w.Write(asset)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	name = testAsset(srv.URL, "1.2.0")["name"].(string)
+
+	baseURL := BaseURL
+	BaseURL = srv.URL
+	VerifyChecksum = true
+	PublicKey = minisignPublicKey(privateKey)
+	DryRun = true
+
+	return func() {
+		BaseURL = baseURL
+		VerifyChecksum = false
+		PublicKey = nil
+		DryRun = false
+		srv.Close()
+	}
+}
+
+func TestInstallDownloadsConcurrently(t *testing.T) {
+	defer assetServer(func(w http.ResponseWriter, r *http.Request) bool {
+		time.Sleep(50 * time.Millisecond)
+		return true
+	})()
+
+	start := time.Now()
+	if _, err := SelfUpdate("axllent/myapp", "myapp", "1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed >= 150*time.Millisecond {
+		t.Errorf("expected the assets to be downloaded concurrently, took %s", elapsed)
+	}
+}
+
+func TestInstallChecksumErrorCancelsDownload(t *testing.T) {
+	defer assetServer(func(w http.ResponseWriter, r *http.Request) bool {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/checksums.txt"):
+			http.Error(w, "checksums unavailable", http.StatusNotFound)
+			return false
+		case strings.HasSuffix(r.URL.Path, ".gz"):
+			// block until the download is cancelled
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return false
+		}
+		return true
+	})()
+
+	start := time.Now()
+	_, err := SelfUpdate("axllent/myapp", "myapp", "1.0.0")
+
+	var se *statusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusNotFound {
+		t.Errorf("expected the checksums error, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed >= 5*time.Second {
+		t.Errorf("expected the download to be cancelled, took %s", elapsed)
+	}
+}
+
+// BenchmarkInstall measures an update with checksum & signature verification,
+// where each asset download has 20ms of latency. The checksums, signature &
+// release asset are downloaded concurrently, so an update takes about one
+// latency rather than three (reported as latency/op).
+func BenchmarkInstall(b *testing.B) {
+	latency := 20 * time.Millisecond
+	defer assetServer(func(w http.ResponseWriter, r *http.Request) bool {
+		time.Sleep(latency)
+		return true
+	})()
+
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		if _, err := SelfUpdate("axllent/myapp", "myapp", "1.0.0"); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportMetric(float64(time.Since(start))/float64(b.N)/float64(latency), "latency/op")
+}
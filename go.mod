@@ -2,4 +2,7 @@ module github.com/axllent/ghru
 
 go 1.13
 
-require github.com/axllent/semver v0.0.1
+require (
+	github.com/axllent/semver v0.0.1
+	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
+)
@@ -0,0 +1,67 @@
+package ghru
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// localDir returns the local release directory if BaseURL is a file:// URL
+// or a directory path rather than a http(s) URL. The directory contains a
+// releases.json (in the format of the Github API) and the release assets,
+// allowing updates to be tested without Github.
+func localDir() (string, bool) {
+	if BaseURL == "" || strings.HasPrefix(BaseURL, "http://") || strings.HasPrefix(BaseURL, "https://") {
+		return "", false
+	}
+
+	if !strings.HasPrefix(BaseURL, "file://") {
+		return BaseURL, true
+	}
+
+	u, err := url.Parse(BaseURL)
+	if err != nil {
+		return strings.TrimPrefix(BaseURL, "file://"), true
+	}
+
+	dir := u.Path
+	if runtime.GOOS == "windows" {
+		// file:///C:/path
+		dir = strings.TrimPrefix(dir, "/")
+	}
+
+	return filepath.FromSlash(dir), true
+}
+
+// localURL returns the file:// URL of a file in the local release directory
+func localURL(name string) string {
+	return "file:///" + url.PathEscape(name)
+}
+
+// localFileURL returns the absolute file:// URL of a file in the local release
+// directory, which (unlike localURL) can be used outside of ghru
+func localFileURL(name string) (string, error) {
+	dir, _ := localDir()
+
+	path, err := filepath.Abs(filepath.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		// file:///C:/path
+		path = "/" + path
+	}
+
+	return (&url.URL{Scheme: "file", Path: path}).String(), nil
+}
+
+// localRoundTrip serves a file:// request from the local release directory
+func localRoundTrip(req *http.Request) (*http.Response, error) {
+	dir, _ := localDir()
+
+	return http.NewFileTransport(http.Dir(dir)).RoundTrip(req)
+}
@@ -0,0 +1,11 @@
+//go:build !windows && !plan9 && !js && !wasip1
+// +build !windows,!plan9,!js,!wasip1
+
+package ghru
+
+import "syscall"
+
+// restart replaces the running process with the binary
+func restart(exe string, args, env []string) error {
+	return syscall.Exec(exe, args, env)
+}
@@ -0,0 +1,35 @@
+package ghru
+
+import (
+	"os"
+	"syscall"
+)
+
+// sameDevice returns whether two paths are on the same filesystem,
+// which cannot be detected on Plan 9
+func sameDevice(a, b string) bool {
+	return true
+}
+
+// isCrossDevice returns whether the error is a cross-device link error
+func isCrossDevice(err error) bool {
+	return false
+}
+
+// preserveOwner is a no-op as file ownership is not preserved on this platform
+func preserveOwner(file string, fi os.FileInfo) {}
+
+// restart replaces the running process with the binary
+func restart(exe string, args, env []string) error {
+	return syscall.Exec(exe, args, env)
+}
+
+// rename renames (moves) a file
+func rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+// removeLater removes a file which is no longer needed
+func removeLater(file string) {
+	_ = os.Remove(file)
+}
@@ -0,0 +1,54 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package ghru
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// sameDevice returns whether two paths are on the same filesystem (device)
+func sameDevice(a, b string) bool {
+	fa, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+
+	fb, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+
+	sa, okA := fa.Sys().(*syscall.Stat_t)
+	sb, okB := fb.Sys().(*syscall.Stat_t)
+	if !okA || !okB {
+		return true
+	}
+
+	return sa.Dev == sb.Dev
+}
+
+// isCrossDevice returns whether the error is a cross-device link error
+func isCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
+
+// preserveOwner sets the owner & group of the file to those of fi where
+// permitted, ie: when running as root
+func preserveOwner(file string, fi os.FileInfo) {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		_ = os.Chown(file, int(st.Uid), int(st.Gid))
+	}
+}
+
+// rename renames (moves) a file
+func rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+// removeLater removes a file which is no longer needed
+func removeLater(file string) {
+	_ = os.Remove(file)
+}
@@ -0,0 +1,60 @@
+//go:build !windows && !plan9 && !js && !wasip1
+// +build !windows,!plan9,!js,!wasip1
+
+package ghru
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestExtractExistingFileMode(t *testing.T) {
+	defer syscall.Umask(syscall.Umask(077))
+
+	for _, name := range []string{"myapp.gz", "myapp"} {
+		dir, err := ioutil.TempDir("", "ghru-test-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		src := filepath.Join(dir, name)
+		content := testBinary
+		if name == "myapp.gz" {
+			content = testGzip()
+		}
+		if err := ioutil.WriteFile(src, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		destDir := filepath.Join(dir, "dest")
+		if err := os.Mkdir(destDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		// an existing non-executable file is overwritten
+		dst := filepath.Join(destDir, "myapp")
+		if err := ioutil.WriteFile(dst, []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(dst, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := Extract(src, destDir); err != nil {
+			t.Fatal(err)
+		}
+
+		info, err := os.Stat(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Mode().Perm() != 0755 {
+			t.Errorf("%s: expected mode 0755, got %#o", name, info.Mode().Perm())
+		}
+	}
+}
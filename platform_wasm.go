@@ -0,0 +1,14 @@
+//go:build js || wasip1
+// +build js wasip1
+
+package ghru
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// restart is not supported as processes cannot be executed on this platform
+func restart(exe string, args, env []string) error {
+	return fmt.Errorf("Restarting is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,103 @@
+package ghru
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	// errorAccessDenied is the Windows ERROR_ACCESS_DENIED error code
+	errorAccessDenied syscall.Errno = 5
+	// errorSharingViolation is the Windows ERROR_SHARING_VIOLATION error code
+	errorSharingViolation syscall.Errno = 32
+	// errorNotSameDevice is the Windows ERROR_NOT_SAME_DEVICE error code
+	errorNotSameDevice syscall.Errno = 17
+	// moveFileDelayUntilReboot is the MoveFileEx MOVEFILE_DELAY_UNTIL_REBOOT flag
+	moveFileDelayUntilReboot = 0x4
+)
+
+// renameAttempts is the number of times a locked file is renamed before giving up
+const renameAttempts = 10
+
+var procMoveFileExW = syscall.NewLazyDLL("kernel32.dll").NewProc("MoveFileExW")
+
+// sameDevice returns whether two paths are on the same volume
+func sameDevice(a, b string) bool {
+	absA, err := filepath.Abs(a)
+	if err != nil {
+		return false
+	}
+
+	absB, err := filepath.Abs(b)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(filepath.VolumeName(absA), filepath.VolumeName(absB))
+}
+
+// isCrossDevice returns whether the error is a cross-volume move error
+func isCrossDevice(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
+
+// preserveOwner is a no-op as file ownership is not preserved on this platform
+func preserveOwner(file string, fi os.FileInfo) {}
+
+// restart starts the binary as a new process and exits, as Windows
+// cannot replace the running process
+func restart(exe string, args, env []string) error {
+	cmd := exec.Command(exe, args[1:]...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	os.Exit(0)
+
+	return nil
+}
+
+// rename renames (moves) a file, retrying when the file is temporarily locked,
+// eg: by antivirus software scanning the new binary
+func rename(oldpath, newpath string) error {
+	var err error
+	for i := 0; i < renameAttempts; i++ {
+		if err = os.Rename(oldpath, newpath); err == nil {
+			return nil
+		}
+
+		if !errors.Is(err, errorAccessDenied) && !errors.Is(err, errorSharingViolation) {
+			return err
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return err
+}
+
+// removeLater removes a file, or schedules it to be removed on the next reboot
+// if it is still in use (requires administrator privileges)
+func removeLater(file string) {
+	if err := os.Remove(file); err == nil || os.IsNotExist(err) {
+		return
+	}
+
+	p, err := syscall.UTF16PtrFromString(file)
+	if err != nil {
+		return
+	}
+
+	_, _, _ = procMoveFileExW.Call(uintptr(unsafe.Pointer(p)), 0, moveFileDelayUntilReboot)
+}
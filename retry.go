@@ -0,0 +1,56 @@
+package ghru
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// MaxRetries is the number of times a failed request is retried on network
+// errors or server (5xx) errors. Client (4xx) errors are never retried.
+var MaxRetries = 0
+
+// RetryBackoff is the delay before the first retry, doubling after each attempt
+var RetryBackoff = time.Second
+
+// withRetry calls fn until it succeeds, returns an error which cannot be
+// resolved by retrying, or MaxRetries is reached
+func withRetry(ctx context.Context, fn func() error) error {
+	backoff := RetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= MaxRetries || ctx.Err() != nil || !isRetryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+	}
+}
+
+// isRetryable returns whether an error is transient (network or server error)
+func isRetryable(err error) bool {
+	if errors.Is(err, ErrHostNotAllowed) {
+		return false
+	}
+
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.StatusCode >= 500
+	}
+
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,149 @@
+package ghru
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// PublicKey is an optional minisign public key (the contents of the public key
+// file, or the base64 encoded key). If set, the downloaded release asset must
+// have a valid minisign signature before it is installed.
+var PublicKey []byte
+
+// SignatureAsset is the name of the release asset containing the minisign
+// signature. It is a template which may contain {{.Name}}, {{.Version}},
+// {{.Tag}}, {{.Asset}} (the release asset filename) and {{.Arm}} (the ARM version).
+var SignatureAsset = "{{.Asset}}.minisig"
+
+// fetchSignature downloads the release signature asset
+func fetchSignature(ctx context.Context, rel Release) ([]byte, error) {
+	if rel.SignatureURL == "" {
+		return nil, fmt.Errorf("No signature asset found for %s", rel.Name)
+	}
+
+	ctx, cancel := withTimeout(ctx, RequestTimeout)
+	defer cancel()
+
+	resp, err := httpGet(ctx, rel.SignatureURL, "application/octet-stream")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+}
+
+// verifySignature verifies the downloaded file against the signature
+// using the PublicKey
+func verifySignature(rel Release, file string, sig []byte) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := minisignVerify(PublicKey, sig, f); err != nil {
+		return fmt.Errorf("Signature verification of %s failed: %s", rel.Name, err)
+	}
+
+	return nil
+}
+
+// minisignVerify verifies a minisign signature of the data read from r
+func minisignVerify(publicKey, signature []byte, r io.Reader) error {
+	pk, err := decodeMinisignLine(publicKey, 42)
+	if err != nil {
+		return fmt.Errorf("invalid public key: %s", err)
+	}
+
+	if string(pk[:2]) != "Ed" {
+		return fmt.Errorf("unsupported public key algorithm")
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(signature)), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return fmt.Errorf("invalid signature format")
+	}
+
+	sig, err := decodeMinisignLine([]byte(lines[1]), 74)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %s", err)
+	}
+
+	if !bytes.Equal(sig[2:10], pk[2:10]) {
+		return fmt.Errorf("signature was created with a different key")
+	}
+
+	var message []byte
+	switch string(sig[:2]) {
+	case "Ed":
+		// legacy signature of the raw file
+		if message, err = ioutil.ReadAll(r); err != nil {
+			return err
+		}
+	case "ED":
+		// signature of the BLAKE2b-512 hash of the file
+		h, _ := blake2b.New512(nil)
+		if _, err := io.Copy(h, r); err != nil {
+			return err
+		}
+		message = h.Sum(nil)
+	default:
+		return fmt.Errorf("unsupported signature algorithm")
+	}
+
+	key := ed25519.PublicKey(pk[10:])
+
+	if !ed25519.Verify(key, message, sig[10:]) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	// the global signature covers the signature and the trusted comment
+	globalSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return fmt.Errorf("invalid global signature")
+	}
+
+	trustedComment := strings.TrimPrefix(strings.TrimRight(lines[2], "\r"), "trusted comment: ")
+	signed := append(append([]byte{}, sig[10:]...), trustedComment...)
+	if !ed25519.Verify(key, signed, globalSig) {
+		return fmt.Errorf("invalid global signature")
+	}
+
+	return nil
+}
+
+// decodeMinisignLine decodes the base64 encoded key or signature of the given
+// length, skipping any "untrusted comment" line
+func decodeMinisignLine(data []byte, length int) ([]byte, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "untrusted comment:") {
+			continue
+		}
+
+		b, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(b) != length {
+			return nil, fmt.Errorf("unexpected length %d", len(b))
+		}
+
+		return b, nil
+	}
+
+	return nil, fmt.Errorf("no data found")
+}
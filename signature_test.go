@@ -0,0 +1,85 @@
+package ghru
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// readTestdata returns the contents of a file in testdata/minisign
+func readTestdata(t *testing.T, name string) []byte {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "minisign", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func TestMinisignVerify(t *testing.T) {
+	data := readTestdata(t, "data.txt")
+	publicKey := readTestdata(t, "minisign.pub")
+	hashed := readTestdata(t, "data.txt.minisig")
+	legacy := readTestdata(t, "data.txt.legacy.minisig")
+
+	// the base64 encoded key, without the untrusted comment
+	keyLine := []byte(strings.Split(string(publicKey), "\n")[1])
+
+	tests := []struct {
+		name      string
+		publicKey []byte
+		signature []byte
+		data      []byte
+		err       string
+	}{
+		{"prehashed", publicKey, hashed, data, ""},
+		{"legacy", publicKey, legacy, data, ""},
+		{"key without comment", keyLine, hashed, data, ""},
+		{"tampered file", publicKey, hashed, append([]byte("x"), data...), "invalid signature"},
+		{"tampered legacy file", publicKey, legacy, append([]byte("x"), data...), "invalid signature"},
+		{"tampered trusted comment", publicKey, bytes.Replace(hashed, []byte("timestamp:1700000000"), []byte("timestamp:1800000000"), 1), data, "invalid global signature"},
+		{"mismatched key id", readTestdata(t, "other.pub"), hashed, data, "different key"},
+		{"malformed public key", []byte("RWQinvalid"), hashed, data, "invalid public key"},
+		{"malformed signature", publicKey, []byte("untrusted comment: x\nRWQinvalid\ntrusted comment: x\nx\n"), data, "invalid signature"},
+		{"missing trusted comment", publicKey, bytes.Replace(hashed, []byte("\ntrusted comment: "), []byte("\n"), 1), data, "invalid signature format"},
+	}
+
+	for _, tt := range tests {
+		err := minisignVerify(tt.publicKey, tt.signature, bytes.NewReader(tt.data))
+		if tt.err == "" && err != nil {
+			t.Errorf("%s: expected a valid signature, got %v", tt.name, err)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: expected %q, got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+// minisignKeyID is the key ID of the test keys
+var minisignKeyID = []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+// minisignPublicKey returns the minisign public key of the private key
+func minisignPublicKey(privateKey ed25519.PrivateKey) []byte {
+	pk := append(append([]byte("Ed"), minisignKeyID...), privateKey.Public().(ed25519.PublicKey)...)
+
+	return []byte(base64.StdEncoding.EncodeToString(pk))
+}
+
+// minisignSign returns a prehashed minisign signature of the data
+func minisignSign(privateKey ed25519.PrivateKey, data []byte) []byte {
+	hash := blake2b.Sum512(data)
+	sig := ed25519.Sign(privateKey, hash[:])
+	trustedComment := "timestamp:1700000000"
+	globalSig := ed25519.Sign(privateKey, append(append([]byte{}, sig...), trustedComment...))
+
+	return []byte(fmt.Sprintf("untrusted comment: signature from minisign secret key\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(append(append([]byte("ED"), minisignKeyID...), sig...)),
+		trustedComment, base64.StdEncoding.EncodeToString(globalSig)))
+}
@@ -0,0 +1,242 @@
+package ghru
+
+import (
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/axllent/semver"
+)
+
+// VersionScheme is the versioning scheme of the release tags, either "semver"
+// (semantic versions, eg: 1.2.3) or "calver" (numeric dot-separated versions
+// such as dates, eg: 2024.11.05). Release tags which are not valid versions of
+// the scheme are ignored.
+var VersionScheme = "semver"
+
+// NormalizeVersion returns the version with surrounding whitespace removed and
+// a leading "v", eg: "1.2.3" => "v1.2.3". Versions which are not valid semantic
+// versions are returned unchanged (apart from the whitespace).
+func NormalizeVersion(version string) string {
+	version = strings.TrimSpace(version)
+
+	if !semver.IsValid(version) {
+		return version
+	}
+
+	return "v" + strings.TrimPrefix(version, "v")
+}
+
+// CompareVersions compares two versions, returning 0 if a == b, -1 if a < b,
+// or 1 if a > b. Invalid versions are considered less than valid ones.
+func CompareVersions(a, b string) int {
+	if VersionScheme == "calver" {
+		return compareCalver(a, b)
+	}
+
+	return semver.Compare(NormalizeVersion(a), NormalizeVersion(b))
+}
+
+// IsNewer returns whether the candidate version is newer than the current version
+func IsNewer(candidate, current string) bool {
+	return CompareVersions(candidate, current) == 1
+}
+
+// GreaterThan compares the current version to a different version
+// returning < 1 not upgradeable. It is the same as IsNewer.
+func GreaterThan(toVer, fromVer string) bool {
+	return IsNewer(toVer, fromVer)
+}
+
+// IsPrerelease returns whether the version is a pre-release version,
+// eg: 1.2.3-beta.1. It can be used with the current version to detect
+// users running a pre-release build.
+func IsPrerelease(version string) bool {
+	return versionPrerelease(version) != ""
+}
+
+// VersionFromBuildInfo returns the module version of the running binary from
+// its build info, eg: when installed with `go install <module>@v1.2.3`. An
+// empty string is returned for development builds, binaries built without
+// module support, or within the module itself (eg: `go build`), in which case
+// the version must be set explicitly.
+func VersionFromBuildInfo() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Version == "(devel)" {
+		return ""
+	}
+
+	return info.Main.Version
+}
+
+// isValidVersion returns whether the version is valid for the VersionScheme
+func isValidVersion(version string) bool {
+	if VersionScheme == "calver" {
+		_, _, ok := parseCalver(version)
+		return ok
+	}
+
+	return semver.IsValid(NormalizeVersion(version))
+}
+
+// versionPrerelease returns the pre-release suffix of the version
+// (eg: "-beta.1"), or an empty string if it is not a pre-release
+func versionPrerelease(version string) string {
+	if VersionScheme == "calver" {
+		_, pre, _ := parseCalver(version)
+		return pre
+	}
+
+	return semver.Prerelease(NormalizeVersion(version))
+}
+
+// versionMajor returns the major version (the first number) of the version,
+// or an empty string if the version is invalid
+func versionMajor(version string) string {
+	if VersionScheme == "calver" {
+		segments, _, ok := parseCalver(version)
+		if !ok {
+			return ""
+		}
+		return strconv.Itoa(segments[0])
+	}
+
+	return semver.Major(NormalizeVersion(version))
+}
+
+// versionBase returns the version without the pre-release suffix
+// or build metadata, eg: "1.2.3-beta+abc" => "1.2.3"
+func versionBase(version string) string {
+	return strings.SplitN(strings.SplitN(version, "+", 2)[0], "-", 2)[0]
+}
+
+// parseCalver parses a numeric dot-separated version with an optional leading
+// "v" and pre-release suffix, eg: "2024.11.05-rc1"
+func parseCalver(version string) (segments []int, prerelease string, ok bool) {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+
+	if i := strings.Index(version, "-"); i >= 0 {
+		version, prerelease = version[:i], version[i:]
+		if prerelease == "-" {
+			return nil, "", false
+		}
+	}
+
+	for _, s := range strings.Split(version, ".") {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 || strings.HasPrefix(s, "+") {
+			return nil, "", false
+		}
+		segments = append(segments, n)
+	}
+
+	return segments, prerelease, true
+}
+
+// compareCalver compares two numeric dot-separated versions segment by segment.
+// Missing segments are treated as 0, and pre-releases are older than releases.
+// Pre-release suffixes are compared with comparePrerelease.
+func compareCalver(a, b string) int {
+	sa, preA, okA := parseCalver(a)
+	sb, preB, okB := parseCalver(b)
+
+	switch {
+	case !okA && !okB:
+		return 0
+	case !okA:
+		return -1
+	case !okB:
+		return 1
+	}
+
+	for i := 0; i < len(sa) || i < len(sb); i++ {
+		var x, y int
+		if i < len(sa) {
+			x = sa[i]
+		}
+		if i < len(sb) {
+			y = sb[i]
+		}
+
+		if x != y {
+			if x > y {
+				return 1
+			}
+			return -1
+		}
+	}
+
+	switch {
+	case preA == preB:
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	default:
+		return comparePrerelease(preA, preB)
+	}
+}
+
+// comparePrerelease compares two pre-release suffixes, comparing runs of digits
+// numerically and everything else lexically, eg: "-rc2" < "-rc10"
+func comparePrerelease(a, b string) int {
+	for a != "" && b != "" {
+		var x, y string
+		x, a = nextPrereleasePart(a)
+		y, b = nextPrereleasePart(b)
+
+		if x == y {
+			continue
+		}
+
+		if isDigits(x) && isDigits(y) {
+			x, y = strings.TrimLeft(x, "0"), strings.TrimLeft(y, "0")
+			if len(x) != len(y) {
+				if len(x) > len(y) {
+					return 1
+				}
+				return -1
+			}
+		}
+
+		if x > y {
+			return 1
+		}
+		if x < y {
+			return -1
+		}
+	}
+
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return -1
+	default:
+		return 1
+	}
+}
+
+// nextPrereleasePart returns the leading run of digits or non-digits of s,
+// and the remainder
+func nextPrereleasePart(s string) (part, rest string) {
+	digit := isDigits(s[:1])
+	i := 1
+	for i < len(s) && isDigits(s[i:i+1]) == digit {
+		i++
+	}
+
+	return s[:i], s[i:]
+}
+
+// isDigits returns whether s consists only of ASCII digits
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return s != ""
+}
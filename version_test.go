@@ -0,0 +1,96 @@
+package ghru
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCalver(t *testing.T) {
+	tests := []struct {
+		version    string
+		segments   []int
+		prerelease string
+		ok         bool
+	}{
+		{"2024.11.05", []int{2024, 11, 5}, "", true},
+		{"v2024.11", []int{2024, 11}, "", true},
+		{" 2024.11.05-rc1 ", []int{2024, 11, 5}, "-rc1", true},
+		{"2024.11.05-rc.1", []int{2024, 11, 5}, "-rc.1", true},
+		{"2024.11.05-", nil, "", false},
+		{"2024.x", nil, "", false},
+		{"2024.-1", nil, "", false},
+		{"2024.+1", nil, "", false},
+		{"2024..1", nil, "", false},
+		{"", nil, "", false},
+	}
+
+	for _, tt := range tests {
+		segments, prerelease, ok := parseCalver(tt.version)
+		if ok != tt.ok || prerelease != tt.prerelease || !reflect.DeepEqual(segments, tt.segments) {
+			t.Errorf("%q: expected %v %q %v, got %v %q %v", tt.version,
+				tt.segments, tt.prerelease, tt.ok, segments, prerelease, ok)
+		}
+	}
+}
+
+func TestCompareCalver(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"2024.11.05", "2024.11.05", 0},
+		{"2024.11.05", "v2024.11.05", 0},
+		{"2024.11", "2024.11.0", 0},
+		{"2024.11.05", "2024.11.04", 1},
+		{"2024.9.1", "2024.11.1", -1},
+		{"2025.1", "2024.12.31", 1},
+		{"2024.11.05-rc1", "2024.11.05", -1},
+		{"2024.11.05", "2024.11.05-rc1", 1},
+		{"2024.11.05-rc1", "2024.11.04", 1},
+		{"2024.11.05-rc2", "2024.11.05-rc10", -1},
+		{"2024.11.05-rc.10", "2024.11.05-rc.2", 1},
+		{"2024.11.05-rc02", "2024.11.05-rc2", 0},
+		{"2024.11.05-beta", "2024.11.05-rc", -1},
+		{"2024.11.05-rc", "2024.11.05-rc1", -1},
+		{"2024.11.05-rc1", "2024.11.05-rc1.1", -1},
+		{"invalid", "2024.11.05", -1},
+		{"2024.11.05", "invalid", 1},
+		{"invalid", "invalid", 0},
+	}
+
+	for _, tt := range tests {
+		if got := compareCalver(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareCalver(%q, %q): expected %d, got %d", tt.a, tt.b, tt.want, got)
+		}
+	}
+}
+
+func TestIsPrerelease(t *testing.T) {
+	tests := []struct {
+		scheme     string
+		version    string
+		prerelease bool
+	}{
+		{"semver", "1.2.3", false},
+		{"semver", "v1.2.3", false},
+		{"semver", "1.2.3-beta.1", true},
+		{"semver", "v1.2.3-rc1", true},
+		{"semver", "1.2.3+build.5", false},
+		{"semver", "1.2.3-alpha.1.2", true},
+		{"semver", "invalid-beta1", false},
+		{"calver", "2024.11.05", false},
+		{"calver", "v2024.11.05", false},
+		{"calver", "2024.11.05-rc1", true},
+		{"calver", "2024.11-beta.2", true},
+		{"calver", "invalid-rc1", false},
+	}
+
+	defer func() { VersionScheme = "semver" }()
+
+	for _, tt := range tests {
+		VersionScheme = tt.scheme
+		if got := IsPrerelease(tt.version); got != tt.prerelease {
+			t.Errorf("%s %q: expected %v, got %v", tt.scheme, tt.version, tt.prerelease, got)
+		}
+	}
+}